@@ -0,0 +1,149 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import "encoding/binary"
+
+// This file implements frame-of-reference (FOR) bitpacking, which TurboPFor
+// calls bitf (for sorted lists) and bitf1 (for strictly increasing lists).
+//
+// Instead of the values themselves, bitf stores the difference to a start
+// value, i.e. input[i]-start, and bitf1 additionally subtracts the position,
+// i.e. input[i]-start-i-1. For dense docid ranges, these differences are small
+// and hence require only few bits each. In contrast to P4, there are no
+// exceptions: all values are bitpacked with the same number of bits b, which is
+// not stored in the output and has to be kept by the caller.
+//
+// The bitpacked layout is the same one the P4 decoder uses, so the decoding
+// functions are thin wrappers around bitunpack32 and bitunpack256v32.
+
+// Bitf32 returns the number of bits b which Bitfpack32 and Bitfpack256v32
+// require to store input relative to start.
+func Bitf32(input []uint32, start uint32) (b byte) {
+	var max uint32
+	for _, v := range input {
+		if v-start > max {
+			max = v - start
+		}
+	}
+	return bits32(max)
+}
+
+// Bitf132 returns the number of bits b which Bitf1pack32 and Bitf1pack256v32
+// require to store input relative to start.
+func Bitf132(input []uint32, start uint32) (b byte) {
+	var max uint32
+	for i, v := range input {
+		if d := v - start - uint32(i) - 1; d > max {
+			max = d
+		}
+	}
+	return bits32(max)
+}
+
+func forDeltas(input []uint32, start uint32, inc uint32) []uint32 {
+	deltas := make([]uint32, len(input))
+	for i, v := range input {
+		deltas[i] = v - start - inc*uint32(i+1)
+	}
+	return deltas
+}
+
+func forUndo(output []uint32, start uint32, inc uint32) {
+	for i := range output {
+		output[i] += start + inc*uint32(i+1)
+	}
+}
+
+// Bitfpack32 writes input[i]-start to output, using b bits per value.
+func Bitfpack32(input []uint32, output []byte, start uint32, b byte) (written int) {
+	return bitpack32(forDeltas(input, start, 0), output, b)
+}
+
+// Bitfunpack32 fills output from input, reversing Bitfpack32.
+func Bitfunpack32(input []byte, output []uint32, start uint32, b byte) (read int) {
+	read = bitunpack32(input, output, b)
+	forUndo(output, start, 0)
+	return read
+}
+
+// Bitf1pack32 writes input[i]-start-i-1 to output, using b bits per value.
+func Bitf1pack32(input []uint32, output []byte, start uint32, b byte) (written int) {
+	return bitpack32(forDeltas(input, start, 1), output, b)
+}
+
+// Bitf1unpack32 fills output from input, reversing Bitf1pack32.
+func Bitf1unpack32(input []byte, output []uint32, start uint32, b byte) (read int) {
+	read = bitunpack32(input, output, b)
+	forUndo(output, start, 1)
+	return read
+}
+
+// Bitfpack256v32 is like Bitfpack32, but uses the 256v layout of 8 interleaved
+// uint32 accumulators. len(input) must be a multiple of 8 (typically 256).
+func Bitfpack256v32(input []uint32, output []byte, start uint32, b byte) (written int) {
+	return bitpack256v32(forDeltas(input, start, 0), output, b)
+}
+
+// Bitfunpack256v32 fills output from input, reversing Bitfpack256v32.
+func Bitfunpack256v32(input []byte, output []uint32, start uint32, b byte) (read int) {
+	read = bitunpack256v32(input, output, b)
+	forUndo(output, start, 0)
+	return read
+}
+
+// Bitf1pack256v32 is like Bitf1pack32, but uses the 256v layout of 8
+// interleaved uint32 accumulators. len(input) must be a multiple of 8
+// (typically 256).
+func Bitf1pack256v32(input []uint32, output []byte, start uint32, b byte) (written int) {
+	return bitpack256v32(forDeltas(input, start, 1), output, b)
+}
+
+// Bitf1unpack256v32 fills output from input, reversing Bitf1pack256v32.
+func Bitf1unpack256v32(input []byte, output []uint32, start uint32, b byte) (read int) {
+	read = bitunpack256v32(input, output, b)
+	forUndo(output, start, 1)
+	return read
+}
+
+// Bitfnbound32 returns the maximum number of bytes Bitfnenc32 writes for n
+// uint32s. Note that decoding requires 32 extra bytes after the encoded data.
+func Bitfnbound32(n int) int {
+	return 5 + 4*n
+}
+
+// Bitfnenc32 encodes input such that it can be decoded without knowing start
+// and b: it writes the smallest value (start) as little endian uint32, b as one
+// byte, followed by the values encoded with Bitfpack32 relative to start. output
+// must have room for at least Bitfnbound32(len(input)) bytes.
+func Bitfnenc32(input []uint32, output []byte) (written int) {
+	var start uint32
+	for i, v := range input {
+		if i == 0 || v < start {
+			start = v
+		}
+	}
+	b := Bitf32(input, start)
+	binary.LittleEndian.PutUint32(output, start)
+	output[4] = b
+	return 5 + Bitfpack32(input, output[5:], start, b)
+}
+
+// Bitfndec32 fills output from input, reversing Bitfnenc32. The caller must
+// ensure that input holds at least 5 bytes and that input[4] (b) is at most 32.
+func Bitfndec32(input []byte, output []uint32) (read int) {
+	start := binary.LittleEndian.Uint32(input)
+	return 5 + Bitfunpack32(input[5:], output, start, input[4])
+}
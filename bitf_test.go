@@ -0,0 +1,104 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestBitf(t *testing.T) {
+	type packFunc func(input []uint32, output []byte, start uint32, b byte) int
+	type unpackFunc func(input []byte, output []uint32, start uint32, b byte) int
+	for _, test := range []struct {
+		name   string
+		bits   func(input []uint32, start uint32) byte
+		pack   packFunc
+		unpack unpackFunc
+	}{
+		{"bitf32", Bitf32, Bitfpack32, Bitfunpack32},
+		{"bitf132", Bitf132, Bitf1pack32, Bitf1unpack32},
+		{"bitf256v32", Bitf32, Bitfpack256v32, Bitfunpack256v32},
+		{"bitf1256v32", Bitf132, Bitf1pack256v32, Bitf1unpack256v32},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+			for maxgap := uint32(1); maxgap < 1<<27; maxgap <<= 1 {
+				const start = 1000
+				input := make([]uint32, 256)
+				v := uint32(start)
+				for i := range input {
+					v += 1 + uint32(rnd.Int63n(int64(maxgap)))
+					input[i] = v
+				}
+				b := test.bits(input, start)
+				packed := make([]byte, 256*4+32)
+				written := test.pack(input, packed, start, b)
+				if got, want := written, 256*int(b)/8; got != want {
+					t.Fatalf("b=%d: wrote %d bytes, want %d", b, got, want)
+				}
+				output := make([]uint32, len(input))
+				if got, want := test.unpack(packed, output, start, b), written; got != want {
+					t.Fatalf("b=%d: read %d bytes, want %d", b, got, want)
+				}
+				if !reflect.DeepEqual(output, input) {
+					t.Fatalf("b=%d: got %v, want %v", b, output, input)
+				}
+			}
+		})
+	}
+}
+
+func TestBitpack32(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for b := byte(0); b <= 32; b++ {
+		input := make([]uint32, 13) // not a multiple of 8
+		for i := range input {
+			input[i] = uint32(rnd.Uint64() & ((1 << b) - 1))
+		}
+		packed := make([]byte, len(input)*4+32)
+		written := bitpack32(input, packed, b)
+		if got, want := written, (len(input)*int(b)+7)/8; got != want {
+			t.Fatalf("b=%d: wrote %d bytes, want %d", b, got, want)
+		}
+		output := make([]uint32, len(input))
+		if got, want := bitunpack32(packed, output, b), written; got != want {
+			t.Fatalf("b=%d: read %d bytes, want %d", b, got, want)
+		}
+		if !reflect.DeepEqual(output, input) {
+			t.Fatalf("b=%d: got %x, want %x", b, output, input)
+		}
+	}
+}
+
+func TestBitfn32(t *testing.T) {
+	for _, input := range [][]uint32{
+		nil,
+		{7},
+		{5, 3, 1 << 31, 0, 7, 7, 7},
+		{1000, 1001, 1003, 1010, 1100, 1000},
+	} {
+		encoded := make([]byte, Bitfnbound32(len(input))+32)
+		written := Bitfnenc32(input, encoded)
+		output := make([]uint32, len(input))
+		if got, want := Bitfndec32(encoded, output), written; got != want {
+			t.Fatalf("%v: read %d bytes, want %d", input, got, want)
+		}
+		if len(input) > 0 && !reflect.DeepEqual(output, input) {
+			t.Fatalf("got %v, want %v", output, input)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"encoding/binary"
+)
+
+// bitpack32 is the inverse of bitunpack32: it writes the lowest nbits of each
+// input value to output as a little endian bit stream.
+func bitpack32(input []uint32, output []byte, nbits byte) (written int) {
+	var wbits uint // bits waiting in the accumulator
+	var acc uint64 // accumulator (wide enough to hold 32+7 bits)
+	for _, v := range input {
+		acc |= (uint64(v) & ((1 << nbits) - 1)) << wbits
+		wbits += uint(nbits)
+		for wbits >= 8 {
+			output[written] = byte(acc)
+			written++
+			acc >>= 8
+			wbits -= 8
+		}
+	}
+	if wbits > 0 {
+		// flush the partial last byte
+		output[written] = byte(acc)
+		written++
+	}
+	return written
+}
+
+// bitpack256v32 is the inverse of bitunpack256v32: value i goes into
+// accumulator i%8, and the 8 accumulators are written as interleaved
+// little endian uint32s whenever they are full.
+func bitpack256v32(input []uint32, output []byte, nbits byte) (written int) {
+	var bits uint
+	var acc [8]uint64 // accumulator
+	flush := func() {
+		for i := 0; i < 8; i++ {
+			binary.LittleEndian.PutUint32(output[written:], uint32(acc[i]))
+			written += 4
+			acc[i] >>= 32
+		}
+	}
+	for ip := 0; ip < len(input); {
+		for i := 0; i < 8; i++ {
+			acc[i] |= (uint64(input[ip]) & ((1 << nbits) - 1)) << bits
+			ip++
+		}
+		bits += uint(nbits)
+		if bits >= 32 {
+			flush()
+			bits -= 32
+		}
+	}
+	if bits > 0 {
+		flush()
+	}
+	return written
+}
+
+// bits32 returns the number of bits required to represent v.
+func bits32(v uint32) byte {
+	var b byte
+	for ; v != 0; v >>= 1 {
+		b++
+	}
+	return b
+}
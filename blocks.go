@@ -0,0 +1,165 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+// BlockKind is the type of a TurboPFor block, as specified by the first two
+// bits of the block header.
+type BlockKind int
+
+const (
+	// BlockBitpacking blocks contain bitpacked values (no exceptions).
+	BlockBitpacking BlockKind = iota
+
+	// BlockBitpackingExceptions blocks contain an exception presence bitmap,
+	// bitpacked exception values and bitpacked values.
+	BlockBitpackingExceptions
+
+	// BlockBitpackingVBExceptions blocks contain bitpacked values, variable
+	// byte encoded exception values and exception index bytes.
+	BlockBitpackingVBExceptions
+
+	// BlockConstant blocks contain one value for the entire block.
+	BlockConstant
+)
+
+func (k BlockKind) String() string {
+	switch k {
+	case BlockBitpacking:
+		return "bitpacking"
+	case BlockBitpackingExceptions:
+		return "bitpacking+exceptions"
+	case BlockBitpackingVBExceptions:
+		return "bitpacking+vbexceptions"
+	case BlockConstant:
+		return "constant"
+	}
+	return "unknown"
+}
+
+func kindOf(blockType [2]byte) BlockKind {
+	switch blockType {
+	case blockBitpacking:
+		return BlockBitpacking
+	case blockBitpackingExceptions:
+		return BlockBitpackingExceptions
+	case blockBitpackingVBExceptions:
+		return BlockBitpackingVBExceptions
+	default:
+		return BlockConstant
+	}
+}
+
+// BlockInfo describes one block of a TurboPFor stream.
+type BlockInfo struct {
+	Offset int // of the block header, in bytes from the start of the stream
+	Size   int // in bytes, including the block header
+	Values int // number of values: 256, or fewer for the last block
+	Kind   BlockKind
+
+	// B is the number of bits per bitpacked value or, for BlockConstant, the
+	// number of bits of the constant value.
+	B byte
+
+	// BX is the number of bits per bitpacked exception, for
+	// BlockBitpackingExceptions.
+	BX byte
+
+	// Exceptions is the number of exceptions.
+	Exceptions int
+
+	// PackedSize is the size of the bitpacked values in bytes, and
+	// ExceptionSize the size of the exception values (bitpacked or variable
+	// byte encoded, without the bitmap or index bytes).
+	PackedSize, ExceptionSize int
+}
+
+// p4info describes the block of n values at the beginning of input. Only the
+// block header (and exception bitmap or variable byte exceptions, if any) are
+// looked at, the values are not decoded.
+func (d *decoder[T]) p4info(input []byte, n int) BlockInfo {
+	if n == 0 {
+		return BlockInfo{}
+	}
+	blockType, b := header(input[0])
+	info := BlockInfo{
+		Values: n,
+		Kind:   kindOf(blockType),
+		B:      b,
+	}
+	switch blockType {
+	case blockConstant:
+		info.Size = 1 + (int(b)+7)/8
+
+	case blockBitpacking:
+		info.PackedSize = d.packedLen(n, b)
+		info.Size = 1 + info.PackedSize
+
+	case blockBitpackingExceptions:
+		bx, exmap := input[1], input[2:]
+		nex := 0 // number of exceptions
+		for i := 0; i < n; i++ {
+			if exmap[i/8]&(1<<uint(i%8)) != 0 {
+				nex++
+			}
+		}
+		info.BX = bx
+		info.Exceptions = nex
+		info.PackedSize = d.packedLen(n, b)
+		info.ExceptionSize = (nex*int(bx) + 7) / 8
+		info.Size = 2 + (n+7)/8 + info.ExceptionSize + info.PackedSize
+
+	default: // blockBitpackingVBExceptions
+		nex := int(input[1]) // number of exceptions
+		info.Exceptions = nex
+		info.PackedSize = d.packedLen(n, b)
+		info.ExceptionSize = vblen[T](input[2+info.PackedSize:], nex)
+		info.Size = 2 + info.PackedSize + info.ExceptionSize + nex
+	}
+	return info
+}
+
+// VBLen returns the number of bytes of the variable byte encoded exception
+// value starting with x, in BlockBitpackingVBExceptions blocks. If the first
+// exception starts with 0xff, all exceptions are instead stored as-is, as 4
+// byte little endian values following the 0xff byte.
+func VBLen(x byte) int {
+	return vblen1(x)
+}
+
+// p4len returns the number of bytes p4dec would read for a block of n values,
+// without decoding the block.
+func (d *decoder[T]) p4len(input []byte, n int) int {
+	return d.p4info(input, n).Size
+}
+
+// P4nblocks256v32 describes the blocks which P4ndec256v32 would decode when
+// filling n uint32s from input, without decoding them.
+func P4nblocks256v32(input []byte, n int) []BlockInfo {
+	blocks := make([]BlockInfo, 0, (n+255)/256)
+	var offset int
+	for ; n > 0; n -= 256 {
+		d := &v256
+		values := 256
+		if n < 256 {
+			d = &remainder
+			values = n
+		}
+		info := d.p4info(input[offset:], values)
+		info.Offset = offset
+		blocks = append(blocks, info)
+		offset += info.Size
+	}
+	return blocks
+}
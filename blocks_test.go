@@ -0,0 +1,58 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"testing"
+)
+
+func TestP4nblocks256v32(t *testing.T) {
+	input, want := readTestdata(t, "trigram_592137")
+	blocks := P4nblocks256v32(input, len(want))
+	if got, want := len(blocks), (len(want)+255)/256; got != want {
+		t.Fatalf("len(blocks): got %d, want %d", got, want)
+	}
+	var offset, values int
+	for i, info := range blocks {
+		if info.Offset != offset {
+			t.Fatalf("block %d: offset: got %d, want %d", i, info.Offset, offset)
+		}
+		// Decoding the block on its own must consume exactly info.Size bytes:
+		output := make([]uint32, info.Values)
+		if got, want := P4ndec256v32(input[offset:], output), info.Size; got != want {
+			t.Fatalf("block %d: size: got %d, want %d", i, got, want)
+		}
+		var overhead int // header bytes, bitmap, exception indexes
+		switch info.Kind {
+		case BlockBitpacking:
+			overhead = 1
+		case BlockBitpackingExceptions:
+			overhead = 2 + (info.Values+7)/8
+		case BlockBitpackingVBExceptions:
+			overhead = 2 + info.Exceptions
+		}
+		if info.Kind != BlockConstant && info.Size != overhead+info.PackedSize+info.ExceptionSize {
+			t.Fatalf("block %d: size %d does not match PackedSize %d and ExceptionSize %d", i, info.Size, info.PackedSize, info.ExceptionSize)
+		}
+		offset += info.Size
+		values += info.Values
+	}
+	if offset != len(input) {
+		t.Fatalf("blocks cover %d bytes, want %d", offset, len(input))
+	}
+	if values != len(want) {
+		t.Fatalf("blocks cover %d values, want %d", values, len(want))
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// Lists encoded with EncodeListChecksum have FlagChecksum set, and their payload
+// is followed by a checksum trailer, which covers groups of blocks (of 256
+// values each). All fields are little endian:
+//
+//	size  field
+//	   4  number of blocks per group
+//	   …  per group: 4 bytes length of the group’s payload in bytes,
+//	      4 bytes CRC32C (Castagnoli) of the group’s payload
+//	   4  CRC32C of the preceding trailer fields
+//
+// Storing the length of each group allows locating every group without
+// decoding the (potentially corrupt) payload. The trailer has its own checksum,
+// as a damaged length would misplace all following groups.
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrTrailerChecksum is returned for lists whose checksum trailer is damaged.
+// Without the trailer, damaged blocks cannot be located.
+var ErrTrailerChecksum = errors.New("goturbopfor: checksum trailer is damaged")
+
+// A ChecksumError describes a group of blocks whose checksum does not match.
+type ChecksumError struct {
+	FirstBlock int // first damaged block
+	LastBlock  int // last damaged block (inclusive)
+	Offset     int // offset of the group within the payload
+	Length     int // length of the group in bytes
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("goturbopfor: checksum mismatch in blocks %d-%d (values %d-%d, payload bytes %d-%d)",
+		e.FirstBlock, e.LastBlock,
+		e.FirstBlock*256, (e.LastBlock+1)*256-1,
+		e.Offset, e.Offset+e.Length-1)
+}
+
+// ChecksumErrors lists all groups of blocks whose checksum does not match, in
+// block order.
+type ChecksumErrors []*ChecksumError
+
+func (e ChecksumErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "goturbopfor: no checksum errors"
+	case 1:
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more damaged groups)", e[0], len(e)-1)
+}
+
+// blockOffsets returns the offsets within payload at which each block of 256
+// values starts, followed by len(payload).
+func blockOffsets(payload []byte, count int, codec Codec) []int {
+	nblocks := (count + 255) / 256
+	offsets := make([]int, nblocks+1)
+	for i := 1; i < nblocks; i++ {
+		switch codec {
+		case CodecRaw:
+			offsets[i] = i * 256 * 4
+		case CodecP4nenc256v32:
+			offsets[i] = offsets[i-1] + v256.p4len(payload[offsets[i-1]:], 256)
+		case CodecBitfpack32:
+			offsets[i] = 5 + i*32*int(payload[4])
+		}
+	}
+	offsets[nblocks] = len(payload)
+	return offsets
+}
+
+// checksumTrailer returns the checksum trailer for payload.
+func checksumTrailer(payload []byte, count int, codec Codec, blocksPerChecksum int) []byte {
+	offsets := blockOffsets(payload, count, codec)
+	nblocks := len(offsets) - 1
+	trailer := make([]byte, 4, 4+8*((nblocks+blocksPerChecksum-1)/blocksPerChecksum)+4)
+	binary.LittleEndian.PutUint32(trailer, uint32(blocksPerChecksum))
+	for first := 0; first < nblocks; first += blocksPerChecksum {
+		last := first + blocksPerChecksum
+		if last > nblocks {
+			last = nblocks
+		}
+		group := payload[offsets[first]:offsets[last]]
+		var buf [8]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(group)))
+		binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(group, castagnoli))
+		trailer = append(trailer, buf[:]...)
+	}
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], crc32.Checksum(trailer, castagnoli))
+	return append(trailer, buf[:]...)
+}
+
+// checksumGroup is a group of blocks covered by one checksum.
+type checksumGroup struct {
+	firstBlock, lastBlock int // inclusive
+	offset, length        int
+	crc                   uint32
+}
+
+// parseTrailer parses the checksum trailer of a list with header h.
+func parseTrailer(trailer []byte, h ListHeader) ([]checksumGroup, error) {
+	if len(trailer) < 8 {
+		return nil, ErrCorrupt
+	}
+	fields := trailer[:len(trailer)-4]
+	if crc32.Checksum(fields, castagnoli) != binary.LittleEndian.Uint32(trailer[len(fields):]) {
+		return nil, ErrTrailerChecksum
+	}
+	trailer = fields
+	blocksPerChecksum := int(binary.LittleEndian.Uint32(trailer))
+	trailer = trailer[4:]
+	if blocksPerChecksum < 1 {
+		return nil, ErrCorrupt
+	}
+	nblocks := (h.Count + 255) / 256
+	ngroups := (nblocks + blocksPerChecksum - 1) / blocksPerChecksum
+	if len(trailer) != 8*ngroups {
+		return nil, ErrCorrupt
+	}
+	groups := make([]checksumGroup, ngroups)
+	offset := 0
+	for i := range groups {
+		g := &groups[i]
+		g.firstBlock = i * blocksPerChecksum
+		g.lastBlock = g.firstBlock + blocksPerChecksum - 1
+		if g.lastBlock >= nblocks {
+			g.lastBlock = nblocks - 1
+		}
+		g.offset = offset
+		g.length = int(binary.LittleEndian.Uint32(trailer[8*i:]))
+		g.crc = binary.LittleEndian.Uint32(trailer[8*i+4:])
+		offset += g.length
+	}
+	if ngroups > 0 && offset != h.Length {
+		return nil, ErrCorrupt
+	}
+	return groups, nil
+}
+
+// verify returns a *ChecksumError if the checksum of g does not match payload.
+func (g checksumGroup) verify(payload []byte) *ChecksumError {
+	if crc32.Checksum(payload[g.offset:g.offset+g.length], castagnoli) != g.crc {
+		return &ChecksumError{
+			FirstBlock: g.firstBlock,
+			LastBlock:  g.lastBlock,
+			Offset:     g.offset,
+			Length:     g.length,
+		}
+	}
+	return nil
+}
+
+// EncodeListChecksum is like EncodeList, but additionally stores a CRC32C
+// checksum for every group of blocksPerChecksum blocks (of 256 values each).
+// DecodeList verifies the checksums and returns ChecksumErrors which name the
+// damaged blocks.
+func EncodeListChecksum(values []uint32, codec Codec, flags ListFlag, blocksPerChecksum int) ([]byte, error) {
+	if !codec.valid() {
+		return nil, ErrUnknownCodec
+	}
+	if flags&^listFlags != 0 {
+		return nil, ErrUnknownFlags
+	}
+	if blocksPerChecksum < 1 {
+		return nil, errors.New("goturbopfor: blocksPerChecksum must be positive")
+	}
+	flags |= FlagChecksum
+	payload := encodePayload(transform(values, flags), codec)
+	h := ListHeader{
+		Codec:  codec,
+		Flags:  flags,
+		Count:  len(values),
+		Length: len(payload),
+	}
+	trailer := checksumTrailer(payload, len(values), codec, blocksPerChecksum)
+	encoded := h.append(make([]byte, 0, ListHeaderSize+len(payload)+len(trailer)))
+	encoded = append(encoded, payload...)
+	return append(encoded, trailer...), nil
+}
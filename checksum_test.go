@@ -0,0 +1,124 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"testing"
+)
+
+func TestListChecksum(t *testing.T) {
+	_, values := readTestdata(t, "trigram_592137")
+	for _, codec := range []Codec{CodecRaw, CodecP4nenc256v32, CodecBitfpack32} {
+		for _, blocksPerChecksum := range []int{1, 3, 1000} {
+			encoded, err := EncodeListChecksum(values, codec, 0, blocksPerChecksum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeList(encoded)
+			if err != nil {
+				t.Fatalf("%v/%d: DecodeList: %v", codec, blocksPerChecksum, err)
+			}
+			if !reflect.DeepEqual(got, values) {
+				t.Fatalf("%v/%d: DecodeList: values differ", codec, blocksPerChecksum)
+			}
+
+			if _, err := EncodeListChecksum(nil, codec, 0, blocksPerChecksum); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestListChecksumMismatch(t *testing.T) {
+	values := make([]uint32, 10*256)
+	for i := range values {
+		values[i] = uint32(i)
+	}
+	encoded, err := EncodeListChecksum(values, CodecRaw, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flip one bit of value 1500 (block 5) and of value 2500 (block 9)
+	encoded[ListHeaderSize+4*1500] ^= 0x10
+	encoded[ListHeaderSize+4*2500] ^= 0x10
+	_, err = DecodeList(encoded)
+	cerrs, ok := err.(ChecksumErrors)
+	if !ok {
+		t.Fatalf("DecodeList: got %v, want ChecksumErrors", err)
+	}
+	want := ChecksumErrors{
+		{
+			FirstBlock: 4,
+			LastBlock:  7,
+			Offset:     4 * 256 * 4,
+			Length:     4 * 256 * 4,
+		},
+		{
+			FirstBlock: 8,
+			LastBlock:  9,
+			Offset:     8 * 256 * 4,
+			Length:     2 * 256 * 4,
+		},
+	}
+	if !reflect.DeepEqual(cerrs, want) {
+		t.Fatalf("DecodeList: got %+v, want %+v", cerrs, want)
+	}
+}
+
+func TestListChecksumTrailer(t *testing.T) {
+	encoded, err := EncodeListChecksum(make([]uint32, 1000), CodecRaw, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), encoded...))
+	}
+	// reseal replaces the trailer checksum at the end of b with a valid one.
+	reseal := func(b []byte) []byte {
+		h, err := ParseListHeader(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := b[ListHeaderSize+h.Length : len(b)-4]
+		binary.LittleEndian.PutUint32(b[len(b)-4:], crc32.Checksum(fields, castagnoli))
+		return b
+	}
+	for _, test := range []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"truncated", encoded[:len(encoded)-1], ErrTrailerChecksum},
+		{"trailing byte", append(modified(func(b []byte) []byte { return b }), 0), ErrTrailerChecksum},
+		{"length", modified(func(b []byte) []byte { b[len(b)-12] ^= 1; return b }), ErrTrailerChecksum},
+		{"checksum", modified(func(b []byte) []byte { b[len(b)-1] ^= 1; return b }), ErrTrailerChecksum},
+		{"extra group", modified(func(b []byte) []byte {
+			b = append(b[:len(b)-4], make([]byte, 8+4)...)
+			return reseal(b)
+		}), ErrCorrupt},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := DecodeList(test.input); err != test.want {
+				t.Fatalf("DecodeList: got %v, want %v", err, test.want)
+			}
+			if _, _, err := DecodeListLenient(test.input); err != test.want {
+				t.Fatalf("DecodeListLenient: got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gp4-bench runs every codec of this module over a corpus of lists and reports
+// compressed size, encoding and decoding throughput and how often each codec
+// produces the smallest output, to help decide which codec to use.
+//
+// The corpus is either a Debian Code Search index (-idx) or a directory of
+// .want files (little endian uint32s, see testdata).
+package main
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/stapelberg/goturbopfor"
+	"github.com/stapelberg/goturbopfor/index"
+)
+
+var (
+	idx    = flag.String("idx", "", "Debian Code Search index to use as corpus (docid deltas of every trigram)")
+	dir    = flag.String("dir", "", "directory of .want files to use as corpus")
+	delta  = flag.Bool("delta", false, "delta-encode lists before encoding them (index lists already contain deltas)")
+	format = flag.String("format", "csv", "output format: csv or json")
+)
+
+type codec struct {
+	name   string
+	bound  func(n int) int
+	encode func(input []uint32, output []byte) (written int)
+	decode func(input []byte, output []uint32) (read int)
+}
+
+var codecs = []codec{
+	{
+		name:  "raw",
+		bound: func(n int) int { return 4 * n },
+		encode: func(input []uint32, output []byte) int {
+			for i, v := range input {
+				binary.LittleEndian.PutUint32(output[4*i:], v)
+			}
+			return 4 * len(input)
+		},
+		decode: func(input []byte, output []uint32) int {
+			for i := range output {
+				output[i] = binary.LittleEndian.Uint32(input[4*i:])
+			}
+			return 4 * len(output)
+		},
+	},
+
+	{
+		name:   "p4nenc256v32",
+		bound:  goturbopfor.P4nbound256v32,
+		encode: goturbopfor.P4nenc256v32,
+		decode: goturbopfor.P4ndec256v32,
+	},
+
+	{
+		name:   "p4nenc32",
+		bound:  goturbopfor.P4nbound32,
+		encode: goturbopfor.P4nenc32,
+		decode: goturbopfor.P4ndec32,
+	},
+
+	{
+		name:   "bitfpack32",
+		bound:  goturbopfor.Bitfnbound32,
+		encode: goturbopfor.Bitfnenc32,
+		decode: goturbopfor.Bitfndec32,
+	},
+
+	forCodec("bitf1pack32", 1, 0, goturbopfor.Bitf1pack32, goturbopfor.Bitf1unpack32, goturbopfor.Bitf1pack32, goturbopfor.Bitf1unpack32),
+
+	forCodec("bitfpack256v32", 0, 256, goturbopfor.Bitfpack256v32, goturbopfor.Bitfunpack256v32, goturbopfor.Bitfpack32, goturbopfor.Bitfunpack32),
+
+	forCodec("bitf1pack256v32", 1, 256, goturbopfor.Bitf1pack256v32, goturbopfor.Bitf1unpack256v32, goturbopfor.Bitf1pack32, goturbopfor.Bitf1unpack32),
+}
+
+type (
+	forPack   func(input []uint32, output []byte, start uint32, b byte) int
+	forUnpack func(input []byte, output []uint32, start uint32, b byte) int
+)
+
+// forCodec returns a codec for the bitf functions, which do not store start
+// and b: like Bitfnenc32, each block of blockSize values (all values, if
+// blockSize is 0) is preceded by start as little endian uint32 and b. Blocks
+// of blockSize values use pack and unpack, the last block (if it has fewer
+// values) uses packLast and unpackLast. inc is 1 for the bitf1 functions, which
+// store input[i]-start-i-1, and 0 otherwise.
+func forCodec(name string, inc uint32, blockSize int, pack forPack, unpack forUnpack, packLast forPack, unpackLast forUnpack) codec {
+	bits := goturbopfor.Bitf32
+	if inc == 1 {
+		bits = goturbopfor.Bitf132
+	}
+	// next returns the size of the next block and its functions.
+	next := func(n int) (int, forPack, forUnpack) {
+		if blockSize > 0 && n >= blockSize {
+			return blockSize, pack, unpack
+		}
+		return n, packLast, unpackLast
+	}
+	return codec{
+		name: name,
+		bound: func(n int) int {
+			blocks := 1
+			if blockSize > 0 {
+				blocks = (n + blockSize - 1) / blockSize
+			}
+			return 5*blocks + 4*n
+		},
+		encode: func(input []uint32, output []byte) (written int) {
+			for len(input) > 0 {
+				n, pack, _ := next(len(input))
+				block := input[:n]
+				var start uint32
+				for i, v := range block {
+					if s := v - inc*uint32(i+1); i == 0 || s < start {
+						start = s
+					}
+				}
+				b := bits(block, start)
+				binary.LittleEndian.PutUint32(output[written:], start)
+				output[written+4] = b
+				written += 5 + pack(block, output[written+5:], start, b)
+				input = input[n:]
+			}
+			return written
+		},
+		decode: func(input []byte, output []uint32) (read int) {
+			for len(output) > 0 {
+				n, _, unpack := next(len(output))
+				start := binary.LittleEndian.Uint32(input[read:])
+				read += 5 + unpack(input[read+5:], output[:n], start, input[read+4])
+				output = output[n:]
+			}
+			return read
+		},
+	}
+}
+
+// result aggregates the measurements of one codec over the entire corpus.
+type result struct {
+	Codec         string  `json:"codec"`
+	Lists         int     `json:"lists"`
+	Values        int     `json:"values"`
+	Bytes         int     `json:"bytes"`
+	BitsPerInt    float64 `json:"bits_per_int"`
+	EncodeMBPerS  float64 `json:"encode_mb_per_s"` // of uncompressed data
+	DecodeMBPerS  float64 `json:"decode_mb_per_s"` // of uncompressed data
+	Wins          int     `json:"wins"`            // lists for which the codec is smallest
+	WinPercentage float64 `json:"win_percentage"`
+
+	encodeTime, decodeTime time.Duration
+}
+
+// minBatch is the minimum number of values encoded or decoded per time
+// measurement: short lists are repeated, as measuring a single short list would
+// mostly measure the overhead of time.Now.
+const minBatch = 1 << 16
+
+type bench struct {
+	results []result // one per codec
+	encoded []byte   // scratch buffer
+	decoded []uint32 // scratch buffer
+}
+
+func (b *bench) run(values []uint32) error {
+	if *delta {
+		var prev uint32
+		for i, v := range values {
+			values[i], prev = v-prev, v
+		}
+	}
+	reps := 1
+	if len(values) > 0 && len(values) < minBatch {
+		reps = (minBatch + len(values) - 1) / len(values)
+	}
+	winner := -1
+	var smallest int
+	for i, c := range codecs {
+		if bound := c.bound(len(values)) + 32; cap(b.encoded) < bound {
+			b.encoded = make([]byte, bound)
+		}
+		encoded := b.encoded[:cap(b.encoded)]
+		start := time.Now()
+		var written int
+		for j := 0; j < reps; j++ {
+			written = c.encode(values, encoded)
+		}
+		encodeTime := time.Since(start) / time.Duration(reps)
+
+		// TurboPFor decoders read up to 32 bytes past the end of their input.
+		for j := written; j < written+32; j++ {
+			encoded[j] = 0
+		}
+		if cap(b.decoded) < len(values) {
+			b.decoded = make([]uint32, len(values))
+		}
+		decoded := b.decoded[:len(values)]
+		start = time.Now()
+		var read int
+		for j := 0; j < reps; j++ {
+			read = c.decode(encoded, decoded)
+		}
+		decodeTime := time.Since(start) / time.Duration(reps)
+		if read != written || !equal(decoded, values) {
+			return fmt.Errorf("%s: decoding does not reproduce the input", c.name)
+		}
+
+		r := &b.results[i]
+		r.Lists++
+		r.Values += len(values)
+		r.Bytes += written
+		r.encodeTime += encodeTime
+		r.decodeTime += decodeTime
+		if winner == -1 || written < smallest {
+			winner, smallest = i, written
+		}
+	}
+	b.results[winner].Wins++
+	return nil
+}
+
+// equal reports whether a and b contain the same values. Unlike
+// reflect.DeepEqual, it does not distinguish nil from empty slices.
+func equal(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bench) finish() {
+	mbPerS := func(values int, d time.Duration) float64 {
+		if d == 0 {
+			return 0
+		}
+		return float64(4*values) / 1e6 / d.Seconds()
+	}
+	for i := range b.results {
+		r := &b.results[i]
+		if r.Values > 0 {
+			r.BitsPerInt = 8 * float64(r.Bytes) / float64(r.Values)
+		}
+		r.EncodeMBPerS = mbPerS(r.Values, r.encodeTime)
+		r.DecodeMBPerS = mbPerS(r.Values, r.decodeTime)
+		if r.Lists > 0 {
+			r.WinPercentage = 100 * float64(r.Wins) / float64(r.Lists)
+		}
+	}
+}
+
+func writeCSV(w io.Writer, results []result) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"codec", "lists", "values", "bytes", "bits_per_int", "encode_mb_per_s", "decode_mb_per_s", "wins", "win_percentage"})
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, r := range results {
+		cw.Write([]string{
+			r.Codec,
+			strconv.Itoa(r.Lists),
+			strconv.Itoa(r.Values),
+			strconv.Itoa(r.Bytes),
+			f(r.BitsPerInt),
+			f(r.EncodeMBPerS),
+			f(r.DecodeMBPerS),
+			strconv.Itoa(r.Wins),
+			f(r.WinPercentage),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// corpus calls fn for every list of the corpus.
+func corpus(fn func(values []uint32) error) error {
+	if *idx != "" {
+		ix, err := index.OpenIndexOptions(*idx, index.Options{Access: index.AccessSequential})
+		if err != nil {
+			return err
+		}
+		defer ix.Close()
+		for it := ix.All(); it.Next(); {
+			deltas, err := ix.Deltas(it.Index())
+			if err != nil {
+				// Corrupt lists cannot be decoded, so skip them.
+				log.Printf("skipping trigram %v: %v", it.Entry().Trigram, err)
+				continue
+			}
+			if err := fn(deltas); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(*dir, "*.want"))
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		b, err := ioutil.ReadFile(match)
+		if err != nil {
+			return err
+		}
+		values := make([]uint32, len(b)/4)
+		for i := range values {
+			values[i] = binary.LittleEndian.Uint32(b[4*i:])
+		}
+		if err := fn(values); err != nil {
+			return fmt.Errorf("%s: %v", match, err)
+		}
+	}
+	return nil
+}
+
+func logic() error {
+	if (*idx == "") == (*dir == "") {
+		return fmt.Errorf("exactly one of -idx or -dir must be specified")
+	}
+	b := &bench{results: make([]result, len(codecs))}
+	for i, c := range codecs {
+		b.results[i].Codec = c.name
+	}
+	if err := corpus(b.run); err != nil {
+		return err
+	}
+	b.finish()
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(b.results)
+	}
+	return writeCSV(os.Stdout, b.results)
+}
+
+func main() {
+	flag.Parse()
+	if *format != "csv" && *format != "json" {
+		log.Fatalf("unknown -format=%q, expected csv or json", *format)
+	}
+	if err := logic(); err != nil {
+		log.Fatal(err)
+	}
+}
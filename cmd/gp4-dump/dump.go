@@ -0,0 +1,162 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gp4-dump prints an annotated disassembly of a TurboPFor stream (as encoded by
+// p4nenc256v32), block by block.
+//
+// Example:
+//
+//	gp4-dump testdata/trigram_592137.input
+//	gp4-dump -idx /srv/dcs/idx -trigram 6382179
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/stapelberg/goturbopfor"
+	"github.com/stapelberg/goturbopfor/internal/stream"
+)
+
+var jsonFlag = flag.Bool("json", false, "print JSON instead of text (see type block)")
+
+var source stream.Source
+
+func init() {
+	source.Register(flag.CommandLine, "dump")
+}
+
+// exception is a value which does not fit into b bits.
+type exception struct {
+	Index int    `json:"index"` // within the block
+	Value uint32 `json:"value"` // the bits above b
+}
+
+// block is one disassembled TurboPFor block.
+type block struct {
+	Offset int    `json:"offset"` // in bytes from the start of the stream
+	Size   int    `json:"size"`   // in bytes, including the header
+	Header string `json:"header"` // header byte in binary: 2 bits kind, 6 bits b
+	Kind   string `json:"kind"`
+	B      byte   `json:"b"`
+	BX     byte   `json:"bx,omitempty"`
+
+	// Bitmap is the exception presence bitmap (bitpacking+exceptions blocks) in
+	// hex, least significant bit first.
+	Bitmap string `json:"bitmap,omitempty"`
+
+	Exceptions []exception `json:"exceptions,omitempty"`
+	Values     []uint32    `json:"values"`
+}
+
+// disassemble returns the blocks of input. If input is damaged, only the blocks
+// before the first invalid block are returned, together with a
+// *goturbopfor.FormatError describing the invalid block.
+func disassemble(input []byte, n int) ([]block, error) {
+	// Damaged input results in out of range accesses in the decoder, so stop
+	// at the first invalid block.
+	_, err := goturbopfor.Validate(input, n)
+	if ferr, ok := err.(*goturbopfor.FormatError); ok && ferr.Block*256 < n {
+		n = ferr.Block * 256
+	}
+	padded := make([]byte, len(input)+32)
+	copy(padded, input)
+	var blocks []block
+	for _, info := range goturbopfor.P4nblocks256v32(padded, n) {
+		raw := padded[info.Offset : info.Offset+info.Size]
+		b := block{
+			Offset: info.Offset,
+			Size:   info.Size,
+			Header: fmt.Sprintf("%08b", raw[0]),
+			Kind:   info.Kind.String(),
+			B:      info.B,
+			Values: make([]uint32, info.Values),
+		}
+		goturbopfor.P4ndec256v32(padded[info.Offset:], b.Values)
+
+		var indexes []int
+		switch info.Kind {
+		case goturbopfor.BlockBitpackingExceptions:
+			b.BX = info.BX
+			bitmap := raw[2 : 2+(info.Values+7)/8]
+			b.Bitmap = fmt.Sprintf("%x", bitmap)
+			for i := 0; i < info.Values; i++ {
+				if bitmap[i/8]&(1<<uint(i%8)) != 0 {
+					indexes = append(indexes, i)
+				}
+			}
+
+		case goturbopfor.BlockBitpackingVBExceptions:
+			// The exception index bytes are at the end of the block.
+			for _, i := range raw[len(raw)-info.Exceptions:] {
+				indexes = append(indexes, int(i))
+			}
+		}
+		for _, i := range indexes {
+			b.Exceptions = append(b.Exceptions, exception{
+				Index: i,
+				Value: b.Values[i] >> info.B,
+			})
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, err
+}
+
+func printText(w io.Writer, blocks []block) {
+	for i, b := range blocks {
+		fmt.Fprintf(w, "block %d at offset %d (%d bytes, %d values)\n", i, b.Offset, b.Size, len(b.Values))
+		fmt.Fprintf(w, "  header %s %s: %s, b=%d\n", b.Header[:2], b.Header[2:], b.Kind, b.B)
+		switch b.Kind {
+		case goturbopfor.BlockBitpackingExceptions.String():
+			fmt.Fprintf(w, "  bx=%d, exception bitmap: %s\n", b.BX, b.Bitmap)
+		case goturbopfor.BlockConstant.String():
+			fmt.Fprintf(w, "  constant value: %d\n", b.Values[0])
+		}
+		if len(b.Exceptions) > 0 {
+			parts := make([]string, len(b.Exceptions))
+			for j, e := range b.Exceptions {
+				parts[j] = fmt.Sprintf("[%d]=%d<<%d", e.Index, e.Value, b.B)
+			}
+			fmt.Fprintf(w, "  %d exceptions: %s\n", len(b.Exceptions), strings.Join(parts, " "))
+		}
+		fmt.Fprintf(w, "  values: %v\n", b.Values)
+	}
+}
+
+func main() {
+	flag.Parse()
+	input, n, _, err := source.Load(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	blocks, err := disassemble(input, n)
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(blocks); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printText(os.Stdout, blocks)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gp4-stats analyzes how the lists of a Debian Code Search index are
+// compressed, to understand why some indexes compress badly.
+package main
+
+import (
+	"container/heap"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/stapelberg/goturbopfor"
+	"github.com/stapelberg/goturbopfor/index"
+)
+
+var top = flag.Int("top", 10, "number of largest trigrams to list")
+
+// list is the size of one trigram’s list.
+type list struct {
+	trigram index.Trigram
+	bytes   int
+	entries int
+}
+
+// largest keeps the n largest lists, according to less.
+type largest struct {
+	n     int
+	less  func(a, b list) bool
+	lists []list // min-heap
+}
+
+func (l *largest) Len() int           { return len(l.lists) }
+func (l *largest) Less(i, j int) bool { return l.less(l.lists[i], l.lists[j]) }
+func (l *largest) Swap(i, j int)      { l.lists[i], l.lists[j] = l.lists[j], l.lists[i] }
+func (l *largest) Push(x interface{}) { l.lists = append(l.lists, x.(list)) }
+func (l *largest) Pop() (x interface{}) {
+	x, l.lists = l.lists[len(l.lists)-1], l.lists[:len(l.lists)-1]
+	return x
+}
+
+func (l *largest) add(li list) {
+	if l.n <= 0 {
+		return
+	}
+	if len(l.lists) < l.n {
+		heap.Push(l, li)
+	} else if l.less(l.lists[0], li) {
+		l.lists[0] = li
+		heap.Fix(l, 0)
+	}
+}
+
+// sorted returns the lists, largest first.
+func (l *largest) sorted() []list {
+	sorted := append([]list(nil), l.lists...)
+	sort.Slice(sorted, func(i, j int) bool { return l.less(sorted[j], sorted[i]) })
+	return sorted
+}
+
+type stats struct {
+	lists   int
+	corrupt int // lists which were skipped because they failed validation
+	blocks  int
+	entries int
+	bytes   int
+
+	kinds         [4]int  // number of blocks per goturbopfor.BlockKind
+	kindBytes     [4]int  // number of bytes per goturbopfor.BlockKind
+	b             [64]int // number of blocks per b (excluding constant blocks)
+	bx            [64]int // number of blocks per bx (exception bitmap blocks)
+	exceptionRate [11]int // number of blocks per 10% of exceptions
+
+	byBytes, byEntries *largest
+}
+
+func (s *stats) add(t index.Trigram, blocks []goturbopfor.BlockInfo) {
+	li := list{trigram: t}
+	for _, info := range blocks {
+		s.blocks++
+		s.kinds[info.Kind]++
+		s.kindBytes[info.Kind] += info.Size
+		if info.Kind != goturbopfor.BlockConstant {
+			s.b[info.B]++
+		}
+		if info.Kind == goturbopfor.BlockBitpackingExceptions {
+			s.bx[info.BX]++
+		}
+		s.exceptionRate[10*info.Exceptions/info.Values]++
+		li.bytes += info.Size
+		li.entries += info.Values
+	}
+	s.lists++
+	s.entries += li.entries
+	s.bytes += li.bytes
+	s.byBytes.add(li)
+	s.byEntries.add(li)
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+func bitsPerInt(bytes, entries int) float64 {
+	if entries == 0 {
+		return 0
+	}
+	return 8 * float64(bytes) / float64(entries)
+}
+
+// histogram prints the non-zero buckets of counts.
+func histogram(w io.Writer, title string, counts []int, label func(i int) string) {
+	var total int
+	for _, c := range counts {
+		total += c
+	}
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for i, c := range counts {
+		if c == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "  %-24s %10d (%5.1f%%)\n", label(i), c, percent(c, total))
+	}
+}
+
+func (s *stats) print(w io.Writer) {
+	fmt.Fprintf(w, "lists:          %d\n", s.lists)
+	if s.corrupt > 0 {
+		fmt.Fprintf(w, "corrupt lists:  %d (skipped)\n", s.corrupt)
+	}
+	fmt.Fprintf(w, "blocks:         %d\n", s.blocks)
+	fmt.Fprintf(w, "entries:        %d\n", s.entries)
+	fmt.Fprintf(w, "bytes:          %d\n", s.bytes)
+	fmt.Fprintf(w, "bits per int:   %.2f\n", bitsPerInt(s.bytes, s.entries))
+
+	fmt.Fprintf(w, "\nblock kinds:\n")
+	for k, c := range s.kinds {
+		fmt.Fprintf(w, "  %-24s %10d (%5.1f%%), %5.1f%% of bytes\n",
+			goturbopfor.BlockKind(k), c, percent(c, s.blocks), percent(s.kindBytes[k], s.bytes))
+	}
+
+	histogram(w, "bit width b (excluding constant blocks)", s.b[:], func(i int) string {
+		return fmt.Sprintf("b=%d", i)
+	})
+	histogram(w, "exception bit width bx (exception bitmap blocks)", s.bx[:], func(i int) string {
+		return fmt.Sprintf("bx=%d", i)
+	})
+	histogram(w, "exception rate", s.exceptionRate[:], func(i int) string {
+		if i == 10 {
+			return "100%"
+		}
+		return fmt.Sprintf("%d-%d%%", 10*i, 10*i+9)
+	})
+
+	for _, l := range []struct {
+		title string
+		lists []list
+	}{
+		{"by bytes", s.byBytes.sorted()},
+		{"by entries", s.byEntries.sorted()},
+	} {
+		if len(l.lists) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\ntop %d trigrams %s:\n", len(l.lists), l.title)
+		fmt.Fprintf(w, "  %-10s %12s %12s %12s\n", "trigram", "bytes", "entries", "bits per int")
+		for _, li := range l.lists {
+			fmt.Fprintf(w, "  %-10d %12d %12d %12.2f\n", li.trigram, li.bytes, li.entries, bitsPerInt(li.bytes, li.entries))
+		}
+	}
+}
+
+func logic(dir string) error {
+	ix, err := index.OpenIndexOptions(dir, index.Options{Access: index.AccessSequential})
+	if err != nil {
+		return err
+	}
+	defer ix.Close()
+
+	s := &stats{
+		byBytes: &largest{
+			n:    *top,
+			less: func(a, b list) bool { return a.bytes < b.bytes },
+		},
+		byEntries: &largest{
+			n:    *top,
+			less: func(a, b list) bool { return a.entries < b.entries },
+		},
+	}
+	for it := ix.All(); it.Next(); {
+		me := it.Entry()
+		// Corrupt lists (or offsets) result in out of range accesses, e.g.
+		// when counting blocks per bx, so skip them:
+		encoded, err := ix.Encoded(it.Index())
+		if err == nil {
+			err = ix.Validate(it.Index())
+		}
+		if err != nil {
+			log.Printf("skipping trigram %d: %v", me.Trigram, err)
+			s.corrupt++
+			continue
+		}
+		s.add(me.Trigram, goturbopfor.P4nblocks256v32(encoded[:cap(encoded)], int(me.Entries)))
+	}
+	s.print(os.Stdout)
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatalf("usage: %v <Debian Code Search index>", os.Args[0])
+	}
+	if err := logic(flag.Arg(0)); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+
+	"github.com/stapelberg/goturbopfor"
+	"github.com/stapelberg/goturbopfor/index"
+	"github.com/stapelberg/goturbopfor/internal/mmap"
+)
+
+// A reference obtains the docid deltas of an index entry in a way which does
+// not depend on goturbopfor.P4ndec256v32 being correct.
+type reference interface {
+	// decode fills deltas with the docid deltas of the n-th index entry.
+	decode(ix *index.Index, n int, deltas []uint32) error
+
+	// close releases the resources of the reference.
+	close() error
+}
+
+// references maps -mode values to functions opening the corresponding
+// reference for the index in dir.
+var references = map[string]func(dir string, ix *index.Index) (reference, error){
+	"data":      openDataReference,
+	"roundtrip": func(string, *index.Index) (reference, error) { return roundtripReference{}, nil },
+}
+
+// dataReference reads the uncompressed posting.docid.data file, which contains
+// the docid deltas of all index entries (in the order of posting.docid.meta) as
+// little endian uint32s.
+type dataReference struct {
+	f       *mmap.File
+	offsets []int // offset of each index entry within f
+}
+
+func openDataReference(dir string, ix *index.Index) (reference, error) {
+	f, err := mmap.Open(filepath.Join(dir, "posting.docid.data"))
+	if err != nil {
+		return nil, err
+	}
+	offsets := make([]int, 0, ix.Len())
+	var offset int
+	for it := ix.All(); it.Next(); {
+		offsets = append(offsets, offset)
+		offset += 4 * int(it.Entry().Entries)
+	}
+	if size := int(f.Size()); offset > size {
+		f.Close()
+		return nil, fmt.Errorf("posting.docid.data too short: index requires %d bytes, file has %d", offset, size)
+	}
+	return &dataReference{f: f, offsets: offsets}, nil
+}
+
+func (r *dataReference) decode(ix *index.Index, n int, deltas []uint32) error {
+	data := r.f.Data[r.offsets[n]:]
+	for i := range deltas {
+		deltas[i] = binary.LittleEndian.Uint32(data[4*i:])
+	}
+	return nil
+}
+
+func (r *dataReference) close() error {
+	return r.f.Close()
+}
+
+// roundtripReference decodes the index entry, re-encodes the result and
+// decodes it again. This does not detect decoding errors which the encoder
+// mirrors, but it requires no data besides the index.
+type roundtripReference struct{}
+
+func (roundtripReference) close() error { return nil }
+
+func (roundtripReference) decode(ix *index.Index, n int, deltas []uint32) error {
+	encoded, err := ix.Encoded(n)
+	if err != nil {
+		return err
+	}
+	decoded := make([]uint32, len(deltas))
+	goturbopfor.P4ndec256v32(encoded[:cap(encoded)], decoded)
+	reencoded := make([]byte, goturbopfor.P4nbound256v32(len(decoded))+32)
+	goturbopfor.P4nenc256v32(decoded, reencoded)
+	goturbopfor.P4ndec256v32(reencoded, deltas)
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stapelberg/goturbopfor/index"
+)
+
+// Exit codes:
+const (
+	exitOK         = 0
+	exitMismatches = 1 // at least one list did not verify
+	exitIOError    = 2 // verification could not be completed
+)
+
+// mismatch describes a list which did not verify. In -lists mode, lists with
+// several damaged groups of blocks result in one mismatch per group.
+type mismatch struct {
+	// Trigram and Offset identify the list in index mode. Both can be 0, so
+	// they are always present (and 0 in -lists mode).
+	Trigram index.Trigram `json:"trigram"`
+	Offset  int64         `json:"offset"`
+
+	// Path identifies the list in -lists mode.
+	Path string `json:"path,omitempty"`
+
+	// FirstDifference is the index of the first value which goturbopfor
+	// decoded differently than the reference, or -1 if the list could not be
+	// decoded at all (see Error).
+	FirstDifference int `json:"first_difference"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// report is the result of verifying an index, as printed with -format=json.
+type report struct {
+	Lists          uint64     `json:"lists"`
+	Entries        uint64     `json:"entries"`
+	Bytes          uint64     `json:"bytes"`
+	Seconds        float64    `json:"seconds"`
+	BytesPerSecond float64    `json:"bytes_per_second"`
+	Mismatches     []mismatch `json:"mismatches"`
+
+	// Error is set if verification could not be completed, e.g. due to an I/O
+	// error.
+	Error string `json:"error,omitempty"`
+}
+
+var (
+	resultsMu sync.Mutex
+	recorded  []mismatch
+	firstErr  error
+)
+
+func recordMismatch(m mismatch) {
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	recorded = append(recorded, m)
+}
+
+// recordError records err as the reason why verification could not be
+// completed. Only the first error is kept.
+func recordError(err error) {
+	log.Print(err)
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	if firstErr == nil {
+		firstErr = err
+	}
+}
+
+// firstDifference returns the index of the first value which differs between
+// want and got.
+func firstDifference(want, got []uint32) int {
+	for i := range want {
+		if i >= len(got) || want[i] != got[i] {
+			return i
+		}
+	}
+	if len(got) > len(want) {
+		return len(want)
+	}
+	return -1
+}
+
+func newReport(elapsed time.Duration) *report {
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	rep := &report{
+		Lists:      atomic.LoadUint64(&totalLists),
+		Entries:    atomic.LoadUint64(&totalEntries),
+		Bytes:      atomic.LoadUint64(&totalBytes),
+		Seconds:    elapsed.Seconds(),
+		Mismatches: recorded,
+	}
+	if rep.Mismatches == nil {
+		rep.Mismatches = []mismatch{} // encode as [], not null
+	}
+	if elapsed > 0 {
+		rep.BytesPerSecond = float64(rep.Bytes) / elapsed.Seconds()
+	}
+	if firstErr != nil {
+		rep.Error = firstErr.Error()
+	}
+	return rep
+}
+
+func (r *report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *report) log() {
+	log.Printf("rate: %.2f bytes/s", r.BytesPerSecond)
+	log.Printf("total: %d entries in %d lists", r.Entries, r.Lists)
+	if len(r.Mismatches) > 0 {
+		log.Printf("%d mismatches, see above", len(r.Mismatches))
+	}
+}
+
+func (r *report) exitCode() int {
+	if r.Error != "" {
+		return exitIOError
+	}
+	if len(r.Mismatches) > 0 {
+		return exitMismatches
+	}
+	return exitOK
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"reflect"
+
+	"github.com/stapelberg/goturbopfor"
+	"github.com/stapelberg/goturbopfor/index"
+)
+
+// mismatches reports whether goturbopfor.P4ndec256v32 does not decode input
+// into want, or does not consume input entirely.
+func mismatches(input []byte, want []uint32) (mismatch bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			mismatch = true // e.g. out of range access due to a wrong length
+		}
+	}()
+	padded := make([]byte, len(input)+32)
+	copy(padded, input)
+	got := make([]uint32, len(want))
+	read := goturbopfor.P4ndec256v32(padded, got)
+	return read != len(input) || !reflect.DeepEqual(got, want)
+}
+
+// minimize returns the smallest test case which still mismatches: preferably a
+// single block, otherwise the shortest prefix of blocks.
+func minimize(input []byte, want []uint32) (minInput []byte, minWant []uint32) {
+	padded := make([]byte, len(input)+32)
+	copy(padded, input)
+	nblocks := (len(want) + 255) / 256
+	offsets := make([]int, nblocks+1) // offsets[k] is where block k starts
+	tmp := make([]uint32, 256)
+	for k := 0; k < nblocks; k++ {
+		n := len(want) - k*256
+		if n > 256 {
+			n = 256
+		}
+		offsets[k+1] = offsets[k] + goturbopfor.P4ndec256v32(padded[offsets[k]:], tmp[:n])
+		if offsets[k+1] > len(input) {
+			nblocks = k // the remaining blocks cannot be located
+			break
+		}
+	}
+	wantRange := func(first, last int) []uint32 {
+		end := last * 256
+		if end > len(want) {
+			end = len(want)
+		}
+		return want[first*256 : end]
+	}
+
+	for k := 0; k < nblocks; k++ {
+		minInput, minWant = input[offsets[k]:offsets[k+1]], wantRange(k, k+1)
+		if mismatches(minInput, minWant) {
+			return minInput, minWant
+		}
+	}
+	for k := 1; k <= nblocks; k++ {
+		minInput, minWant = input[:offsets[k]], wantRange(0, k)
+		if mismatches(minInput, minWant) {
+			return minInput, minWant
+		}
+	}
+	return input, want
+}
+
+// writeTestcase writes a .input and .want file in the format which
+// goturbopfor’s TestDecodeFromFile reads.
+func writeTestcase(prefix string, input []byte, want []uint32) error {
+	if err := ioutil.WriteFile(prefix+".input", input, 0644); err != nil {
+		return err
+	}
+	b := make([]byte, 4*len(want))
+	for i, v := range want {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	return ioutil.WriteFile(prefix+".want", b, 0644)
+}
+
+// dumpTestcase stores the input and expected output of a mismatching trigram
+// in dir, as well as a minimized version (suffix _min), if it is smaller.
+func dumpTestcase(dir string, t index.Trigram, input []byte, want []uint32) error {
+	prefix := filepath.Join(dir, fmt.Sprintf("trigram_%d", t))
+	if err := writeTestcase(prefix, input, want); err != nil {
+		return err
+	}
+	log.Printf("wrote %s.{input,want} (%d bytes, %d values)", prefix, len(input), len(want))
+	minInput, minWant := minimize(input, want)
+	if len(minInput) == len(input) {
+		return nil
+	}
+	if err := writeTestcase(prefix+"_min", minInput, minWant); err != nil {
+		return err
+	}
+	log.Printf("wrote %s_min.{input,want} (%d bytes, %d values)", prefix, len(minInput), len(minWant))
+	return nil
+}
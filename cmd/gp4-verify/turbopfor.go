@@ -0,0 +1,48 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build turbopfor
+// +build turbopfor
+
+package main
+
+// To compare against the C implementation of TurboPFor, use cgo:
+//
+//	go get github.com/Debian/dcs/internal/turbopfor
+//	ln -s github.com/Debian/dcs/internal/turbopfor turbopfor
+//	go build -tags turbopfor
+import (
+	"turbopfor"
+
+	"github.com/stapelberg/goturbopfor/index"
+)
+
+func init() {
+	references["turbopfor"] = func(string, *index.Index) (reference, error) {
+		return turbopforReference{}, nil
+	}
+}
+
+type turbopforReference struct{}
+
+func (turbopforReference) close() error { return nil }
+
+func (turbopforReference) decode(ix *index.Index, n int, deltas []uint32) error {
+	encoded, err := ix.Encoded(n)
+	if err != nil {
+		return err
+	}
+	turbopfor.P4ndec256v32(encoded[:cap(encoded)], deltas)
+	return nil
+}
@@ -15,9 +15,9 @@
 package main
 
 import (
-	"encoding/binary"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
@@ -30,42 +30,20 @@ import (
 	"sync/atomic"
 	"time"
 
-	// go get github.com/Debian/dcs/internal/turbopfor
-	// ln -s github.com/Debian/dcs/internal/turbopfor turbopfor
-	// </hackerman>
-	"turbopfor"
-
 	"github.com/stapelberg/goturbopfor"
-	"github.com/stapelberg/goturbopfor/internal/mmap"
+	"github.com/stapelberg/goturbopfor/index"
 )
 
 var (
-	idx = flag.String("idx", "", "")
+	idx    = flag.String("idx", "", "")
+	lists  = flag.Bool("lists", false, "verify a directory of encoded lists (see goturbopfor.EncodeList) instead of a Debian Code Search index, reporting all checksum failures")
+	out    = flag.String("out", "", "if non-empty, directory in which to store the input and expected output of mismatching trigrams, for use as testdata")
+	format = flag.String("format", "text", "output format: text (log messages) or json (a report on stdout, see type report)")
+	mode   = flag.String("mode", "data", "what to compare goturbopfor’s decoding against: data (the uncompressed posting.docid.data file), roundtrip (decoding after re-encoding with goturbopfor, which requires no posting.docid.data file but cannot detect a decoder which consistently returns wrong values) or turbopfor (the C implementation, requires -tags turbopfor)")
 )
 
-type Trigram uint32
-
-// A MetaEntry specifies the offset (in the corresponding data file) and number
-// of entries for each trigram.
-type MetaEntry struct {
-	Trigram    Trigram
-	Entries    uint32 // number of entries (excluding padding)
-	OffsetData int64  // delta offset within the corresponding .data or .turbopfor file
-}
-
-var encoding = binary.LittleEndian
-
-func (me *MetaEntry) Unmarshal(b []byte) {
-	me.Trigram = Trigram(encoding.Uint32(b))
-	me.Entries = encoding.Uint32(b[4:])
-	me.OffsetData = int64(encoding.Uint64(b[8:]))
-}
-
-// metaEntrySize is (encoding/binary).Size(&MetaEntry{}), which Go 1.11 does not
-// turn into a compile-time constant yet.
-const metaEntrySize = 16
-
 var (
+	totalLists   uint64
 	totalBytes   uint64
 	totalEntries uint64
 )
@@ -88,67 +66,91 @@ var bufPool = sync.Pool{
 	},
 }
 
-func logic(idx string) error {
-	log.Printf("verifying index %q", idx)
-	md, err := mmap.Open(filepath.Join(idx, "posting.docid.turbopfor"))
+func logic(dir, mode string) error {
+	log.Printf("verifying index %q against %s", dir, mode)
+	ix, err := index.OpenIndexOptions(dir, index.Options{Access: index.AccessSequential})
 	if err != nil {
 		return err
 	}
-	defer md.Close()
-	mf, err := mmap.Open(filepath.Join(idx, "posting.docid.meta"))
+	defer ix.Close()
+	open, ok := references[mode]
+	if !ok {
+		return fmt.Errorf("unknown -mode=%q", mode)
+	}
+	ref, err := open(dir, ix)
 	if err != nil {
 		return err
 	}
-	defer mf.Close()
+	defer ref.close()
 
-	work := make(chan MetaEntry, 4*runtime.NumCPU())
+	work := make(chan int, 4*runtime.NumCPU())
 	var wg sync.WaitGroup
 	for i := 0; i < 2*runtime.NumCPU(); i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for prev := range work {
+			for pos := range work {
+				prev := ix.Entry(pos)
+				encoded, err := ix.Encoded(pos)
+				if err != nil {
+					log.Print(err)
+					recordMismatch(mismatch{
+						Trigram:         prev.Trigram,
+						Offset:          prev.OffsetData,
+						FirstDifference: -1,
+						Error:           err.Error(),
+					})
+					continue
+				}
+				atomic.AddUint64(&totalLists, 1)
+				atomic.AddUint64(&totalBytes, uint64(len(encoded)+index.MetaEntrySize))
+				atomic.AddUint64(&totalEntries, uint64(prev.Entries))
+				padded := encoded[:cap(encoded)]
+
 				n := prev.Entries // for convenience
+				// Corrupt lists result in out of range accesses in the
+				// decoders, so check their structure first:
+				if err := ix.Validate(pos); err != nil {
+					log.Printf("trigram %v: %v", prev.Trigram, err)
+					recordMismatch(mismatch{
+						Trigram:         prev.Trigram,
+						Offset:          prev.OffsetData,
+						FirstDifference: -1,
+						Error:           err.Error(),
+					})
+					continue
+				}
 				deltas := bufPool.Get().([]uint32)
 				if cap(deltas) < 2*(int(n)+32) {
 					deltas = make([]uint32, n, 2*(int(n)+32))
 				}
-				turbopfor.P4ndec256v32(md.Data[prev.OffsetData:], deltas[:n])
+				if err := ref.decode(ix, pos, deltas[:n]); err != nil {
+					recordError(err)
+					bufPool.Put(deltas)
+					continue
+				}
 
-				// measure TurboPFor decoding speed:
+				// measure reference decoding speed:
 				// bufPool.Put(deltas)
 				// continue
 				deltas = deltas[:n]
 
 				deltas2 := make([]uint32, prev.Entries, prev.Entries+32)
-				goturbopfor.P4ndec256v32(md.Data[prev.OffsetData:], deltas2)
+				goturbopfor.P4ndec256v32(padded, deltas2)
 
 				if !reflect.DeepEqual(deltas, deltas2) {
-					log.Printf("read %d bytes at %d for trigram %v: %v (len: %d)", -1 /*meta.OffsetData-prev.OffsetData*/, prev.OffsetData, prev.Trigram, deltas, prev.Entries)
+					log.Printf("read %d bytes at %d for trigram %v: %v (len: %d)", len(encoded), prev.OffsetData, prev.Trigram, deltas, prev.Entries)
 					log.Printf("go: %v", deltas2)
-					//fmt.Printf("input: %#v,\n", buffer[:len(buffer)-32])
-					fmt.Printf("want: %#v,\n", deltas)
-					// dump to turn into a testcase
-					prefix := fmt.Sprintf("/home/michael/go/src/goturbopfor/testdata/trigram_%d", prev.Trigram)
-					want, err := os.Create(prefix + ".want")
-					if err != nil {
-						log.Fatal(err)
-					}
-					defer want.Close()
-					if err := binary.Write(want, binary.LittleEndian, deltas); err != nil {
-						log.Fatal(err)
+					recordMismatch(mismatch{
+						Trigram:         prev.Trigram,
+						Offset:          prev.OffsetData,
+						FirstDifference: firstDifference(deltas, deltas2),
+					})
+					if *out != "" {
+						if err := dumpTestcase(*out, prev.Trigram, encoded, deltas); err != nil {
+							recordError(err)
+						}
 					}
-
-					input, err := os.Create(prefix + ".input")
-					if err != nil {
-						log.Fatal(err)
-					}
-					defer input.Close()
-					// if _, err := input.Write(buffer[:len(buffer)-32]); err != nil {
-					// 	log.Fatal(err)
-					// }
-
-					os.Exit(1)
 				}
 
 				bufPool.Put(deltas)
@@ -156,25 +158,61 @@ func logic(idx string) error {
 		}()
 	}
 
-	max := int(len(mf.Data))/metaEntrySize - 2 /* corrupt? */
-	var meta, prev MetaEntry
-	for i := 0; i < max; i++ {
-		meta.Unmarshal(mf.Data[i*metaEntrySize:])
-		if i == 0 {
-			prev = meta
-			continue
-		}
-		blockLen := meta.OffsetData - prev.OffsetData
-		atomic.AddUint64(&totalBytes, uint64(blockLen+metaEntrySize))
-		atomic.AddUint64(&totalEntries, uint64(prev.Entries))
-		work <- prev
-		prev = meta
+	for it := ix.All(); it.Next(); {
+		work <- it.Index()
 	}
 	close(work)
 	wg.Wait()
 	return nil
 }
 
+// verifyLists decodes every file in dir as an encoded list, recording all
+// checksum failures instead of stopping at the first one.
+func verifyLists(dir string) error {
+	log.Printf("verifying encoded lists in %q", dir)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		atomic.AddUint64(&totalLists, 1)
+		atomic.AddUint64(&totalBytes, uint64(len(b)))
+		values, err := goturbopfor.DecodeList(b)
+		if cerrs, ok := err.(goturbopfor.ChecksumErrors); ok {
+			for _, cerr := range cerrs {
+				log.Printf("%s: blocks %d-%d damaged: %v", path, cerr.FirstBlock, cerr.LastBlock, cerr)
+				recordMismatch(mismatch{
+					Path:            path,
+					FirstDifference: -1,
+					Error:           cerr.Error(),
+				})
+			}
+			if _, missing, err := goturbopfor.DecodeListLenient(b); err == nil {
+				log.Printf("%s: skipping damaged blocks, values %v are missing", path, missing)
+			}
+			return nil
+		}
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			recordMismatch(mismatch{
+				Path:            path,
+				FirstDifference: -1,
+				Error:           err.Error(),
+			})
+			return nil
+		}
+		atomic.AddUint64(&totalEntries, uint64(len(values)))
+		return nil
+	})
+	return err
+}
+
 // Global flags (not command-specific)
 var cpuprofile, memprofile, listen, traceFn string
 
@@ -189,9 +227,18 @@ func init() {
 func main() {
 	flag.Parse()
 	if flag.NArg() != 1 {
-		log.Fatalf("usage: %v <Debian Code Search index>", os.Args[0])
+		log.Printf("usage: %v <Debian Code Search index>", os.Args[0])
+		os.Exit(exitIOError)
 	}
+	if *format != "text" && *format != "json" {
+		log.Printf("unknown -format=%q, expected text or json", *format)
+		os.Exit(exitIOError)
+	}
+	os.Exit(run())
+}
 
+// run verifies the index and returns the process exit code.
+func run() int {
 	if listen != "" {
 		go func() {
 			if err := http.ListenAndServe(listen, nil); err != nil {
@@ -235,10 +282,23 @@ func main() {
 	}
 
 	start := time.Now()
-	if err := logic(flag.Arg(0)); err != nil {
-		log.Fatal(err)
+	var err error
+	if *lists {
+		err = verifyLists(flag.Arg(0))
+	} else {
+		err = logic(flag.Arg(0), *mode)
+	}
+	if err != nil {
+		recordError(err)
+	}
+	rep := newReport(time.Since(start))
+	if *format == "json" {
+		if err := rep.writeJSON(os.Stdout); err != nil {
+			log.Print(err)
+			return exitIOError
+		}
+	} else {
+		rep.log()
 	}
-	val := atomic.LoadUint64(&totalBytes)
-	log.Printf("rate: %.2f bytes/s", float64(val)/float64(time.Since(start).Nanoseconds())*float64(time.Second))
-	log.Printf("total: %d entries", atomic.LoadUint64(&totalEntries))
+	return rep.exitCode()
 }
@@ -0,0 +1,194 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/stapelberg/goturbopfor"
+)
+
+// role is what a bit of an encoded block is used for.
+type role struct {
+	class string // CSS class, which determines the color
+	title string // tooltip
+}
+
+// region is a range of bytes within a block which serve one purpose.
+type region struct {
+	Name        string
+	Offset, Len int // in bytes, relative to the block
+}
+
+// layout assigns a role to every bit of the block described by info. raw is
+// the encoded block.
+func layout(info goturbopfor.BlockInfo, raw []byte) ([]role, []region) {
+	roles := make([]role, 8*len(raw))
+	set := func(bit int, class, title string) {
+		roles[bit] = role{class: class, title: title}
+	}
+	var regions []region
+
+	// The header byte: bits are numbered least significant first, so the two
+	// kind bits are the last two bits of the first byte.
+	for i := 0; i < 6; i++ {
+		set(i, "b", fmt.Sprintf("header: b=%d", info.B))
+	}
+	set(6, "kind", "header: kind "+info.Kind.String())
+	set(7, "kind", "header: kind "+info.Kind.String())
+	regions = append(regions, region{"header", 0, 1})
+	pos := 1
+
+	n := info.Values
+	b := int(info.B)
+	packed := func() {
+		regions = append(regions, region{"packed values", pos, info.PackedSize})
+		if n == 256 {
+			packed256v(roles, pos, info.PackedSize, b)
+		} else {
+			packedHorizontal(roles, pos, n, b)
+		}
+		pos += info.PackedSize
+	}
+
+	switch info.Kind {
+	case goturbopfor.BlockConstant:
+		regions = append(regions, region{"constant value", pos, len(raw) - pos})
+		for bit := 8 * pos; bit < 8*len(raw); bit++ {
+			if bit-8*pos < b {
+				set(bit, "constant", "constant value")
+			} else {
+				set(bit, "unused", "unused")
+			}
+		}
+
+	case goturbopfor.BlockBitpacking:
+		packed()
+
+	case goturbopfor.BlockBitpackingExceptions:
+		for i := 0; i < 8; i++ {
+			set(8*pos+i, "second", fmt.Sprintf("bx=%d", info.BX))
+		}
+		regions = append(regions, region{"bx", pos, 1})
+		pos++
+
+		bitmapLen := (n + 7) / 8
+		regions = append(regions, region{"exception bitmap", pos, bitmapLen})
+		for i := 0; i < 8*bitmapLen; i++ {
+			switch {
+			case i >= n:
+				set(8*pos+i, "unused", "unused")
+			case raw[pos+i/8]&(1<<uint(i%8)) != 0:
+				set(8*pos+i, "bitmap-set", fmt.Sprintf("value %d is an exception", i))
+			default:
+				set(8*pos+i, "bitmap", fmt.Sprintf("value %d is not an exception", i))
+			}
+		}
+		pos += bitmapLen
+
+		bx := int(info.BX)
+		exLen := info.ExceptionSize
+		regions = append(regions, region{"bitpacked exceptions", pos, exLen})
+		for i := 0; i < 8*exLen; i++ {
+			if i >= info.Exceptions*bx {
+				set(8*pos+i, "unused", "unused")
+				continue
+			}
+			set(8*pos+i, fmt.Sprintf("exception%d", (i/bx)%2), fmt.Sprintf("exception %d", i/bx))
+		}
+		pos += exLen
+		packed()
+
+	case goturbopfor.BlockBitpackingVBExceptions:
+		for i := 0; i < 8; i++ {
+			set(8*pos+i, "second", fmt.Sprintf("%d exceptions", info.Exceptions))
+		}
+		regions = append(regions, region{"number of exceptions", pos, 1})
+		pos++
+		packed()
+
+		vbEnd := pos + info.ExceptionSize
+		regions = append(regions, region{"variable byte exceptions", pos, info.ExceptionSize})
+		overflow := info.Exceptions > 0 && raw[pos] == 0xff
+		if overflow {
+			for bit := 8 * pos; bit < 8*(pos+1); bit++ {
+				set(bit, "second", "exceptions stored as-is")
+			}
+			pos++
+		}
+		for i := 0; pos < vbEnd; i++ {
+			l := 4
+			if !overflow {
+				l = goturbopfor.VBLen(raw[pos])
+			}
+			for bit := 8 * pos; bit < 8*(pos+l); bit++ {
+				set(bit, fmt.Sprintf("vb%d", i%2), fmt.Sprintf("variable byte exception %d", i))
+			}
+			pos += l
+		}
+
+		regions = append(regions, region{"exception indexes", pos, info.Exceptions})
+		for i := 0; i < info.Exceptions; i++ {
+			for bit := 8 * (pos + i); bit < 8*(pos+i+1); bit++ {
+				set(bit, "index", fmt.Sprintf("exception %d is value %d", i, raw[pos+i]))
+			}
+		}
+	}
+	return roles, regions
+}
+
+// packed256v assigns roles to the bits of a 256v32 bitpacked block of values,
+// which occupies size bytes starting at byte pos: the values are distributed
+// across 8 accumulators, each of which reads every 8th uint32.
+func packed256v(roles []role, pos, size, b int) {
+	if b == 0 {
+		return
+	}
+	start := 8 * pos
+	for bit := start; bit < start+8*size; bit++ {
+		word := (bit - start) / 32
+		lane := word % 8
+		laneBit := (word/8)*32 + (bit-start)%32 // bit position within the lane
+		value := laneBit / b
+		if value >= 256/8 {
+			roles[bit] = role{class: "unused", title: "unused"}
+			continue
+		}
+		roles[bit] = role{
+			class: fmt.Sprintf("lane%d-%d", lane, value%2),
+			title: fmt.Sprintf("accumulator %d: value %d", lane, 8*value+lane),
+		}
+	}
+}
+
+// packedHorizontal assigns roles to the bits of n horizontally bitpacked
+// values starting at byte pos: the values form a little-endian bitstream.
+func packedHorizontal(roles []role, pos, n, b int) {
+	if b == 0 {
+		return
+	}
+	start := 8 * pos
+	for bit := start; bit < start+8*((n*b+7)/8); bit++ {
+		value := (bit - start) / b
+		if value >= n {
+			roles[bit] = role{class: "unused", title: "unused"}
+			continue
+		}
+		roles[bit] = role{
+			class: fmt.Sprintf("value%d", value%2),
+			title: fmt.Sprintf("value %d", value),
+		}
+	}
+}
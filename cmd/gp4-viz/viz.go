@@ -0,0 +1,261 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gp4-viz renders the bit layout of a TurboPFor stream (as encoded by
+// p4nenc256v32) as a self-contained HTML page with one SVG diagram per block.
+//
+// Every bit is drawn as one square, colored by what it is used for: the header
+// (kind and b), the exception bitmap, bitpacked or variable byte encoded
+// exceptions, and the bitpacked values. For blocks of 256 values, the colors
+// show which of the 8 accumulators each bit of the interleaved 256v32 layout
+// lands in. Bits are drawn least significant first, so that bitstreams read
+// from left to right. Hover over a bit for details.
+//
+// Example:
+//
+//	gp4-viz testdata/trigram_592137.input > /tmp/viz.html
+//	gp4-viz -idx /srv/dcs/idx -trigram 6382179 > /tmp/viz.html
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/stapelberg/goturbopfor"
+	"github.com/stapelberg/goturbopfor/internal/stream"
+)
+
+var (
+	first  = flag.Int("first", 0, "index of the first block to render")
+	blocks = flag.Int("blocks", 8, "maximum number of blocks to render (each block of 256 values takes up to 1 KB)")
+)
+
+var source stream.Source
+
+func init() {
+	source.Register(flag.CommandLine, "render")
+}
+
+const (
+	bytesPerRow = 32 // one group of 8 uint32s in the 256v32 layout
+	cellSize    = 5  // in pixels, per bit
+	rowHeight   = cellSize + 3
+)
+
+type cell struct {
+	X, Y  int
+	Class string
+	Title string
+}
+
+type byteCell struct {
+	X, Y  int
+	Title string
+}
+
+type blockView struct {
+	Index   int
+	Info    goturbopfor.BlockInfo
+	Regions []region
+	Width   int
+	Height  int
+	Bits    []cell
+	Bytes   []byteCell
+}
+
+// render lays out the block described by info as SVG cells.
+func render(i int, info goturbopfor.BlockInfo, raw []byte) blockView {
+	roles, regions := layout(info, raw)
+	rows := (len(raw) + bytesPerRow - 1) / bytesPerRow
+	v := blockView{
+		Index:   i,
+		Info:    info,
+		Regions: regions,
+		Width:   8 * bytesPerRow * cellSize,
+		Height:  rows * rowHeight,
+	}
+	for bit, r := range roles {
+		v.Bits = append(v.Bits, cell{
+			X:     (bit % (8 * bytesPerRow)) * cellSize,
+			Y:     (bit / (8 * bytesPerRow)) * rowHeight,
+			Class: r.class,
+			Title: fmt.Sprintf("byte %d, bit %d: %s", bit/8, bit%8, r.title),
+		})
+	}
+	for off, b := range raw {
+		v.Bytes = append(v.Bytes, byteCell{
+			X:     (off % bytesPerRow) * 8 * cellSize,
+			Y:     (off / bytesPerRow) * rowHeight,
+			Title: fmt.Sprintf("byte %d: %08b", off, b),
+		})
+	}
+	return v
+}
+
+// laneStyles returns the CSS classes for the 8 accumulators of the 256v32
+// layout, in two shades each to tell neighbouring values apart.
+func laneStyles() template.CSS {
+	var b strings.Builder
+	for lane := 0; lane < 8; lane++ {
+		fmt.Fprintf(&b, ".lane%d-0 { fill: hsl(%d, 65%%, 45%%); }\n", lane, lane*45)
+		fmt.Fprintf(&b, ".lane%d-1 { fill: hsl(%d, 65%%, 70%%); }\n", lane, lane*45)
+	}
+	return template.CSS(b.String())
+}
+
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; }
+svg rect.byte { fill: none; stroke: #000; stroke-width: 0.5; pointer-events: none; }
+.kind { fill: #d62728; }
+.b { fill: #ff7f0e; }
+.second { fill: #e6c229; }
+.bitmap { fill: #c7c7c7; }
+.bitmap-set { fill: #7f7f7f; }
+.exception0 { fill: #9467bd; }
+.exception1 { fill: #c5b0d5; }
+.value0 { fill: #1f77b4; }
+.value1 { fill: #aec7e8; }
+.vb0 { fill: #2ca02c; }
+.vb1 { fill: #98df8a; }
+.index { fill: #17becf; }
+.constant { fill: #8c564b; }
+.unused { fill: #f4f4f4; }
+{{ .LaneStyles }}
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<p>
+{{ .Values }} values in {{ .Size }} bytes ({{ .NumBlocks }} blocks).
+Each square is one bit, least significant bit first. Hover over a bit for details.
+</p>
+<p>
+<svg width="{{ .LegendWidth }}" height="20">
+{{ range $i, $l := .Legend }}<rect x="{{ $l.X }}" y="5" width="10" height="10" class="{{ $l.Class }}"/><text x="{{ $l.TextX }}" y="14" font-size="12">{{ $l.Title }}</text>
+{{ end }}</svg>
+</p>
+{{ range .Blocks }}
+<h2>Block {{ .Index }}: {{ .Info.Kind }}, b={{ .Info.B }}{{ if .Info.BX }}, bx={{ .Info.BX }}{{ end }}{{ if .Info.Exceptions }}, {{ .Info.Exceptions }} exceptions{{ end }}</h2>
+<p>
+Offset {{ .Info.Offset }}, {{ .Info.Size }} bytes, {{ .Info.Values }} values:
+{{ range $i, $r := .Regions }}{{ if $i }}, {{ end }}{{ $r.Name }} ({{ $r.Len }} bytes){{ end }}
+</p>
+<svg width="{{ .Width }}" height="{{ .Height }}">
+{{ range .Bits }}<rect x="{{ .X }}" y="{{ .Y }}" width="{{ $.CellSize }}" height="{{ $.CellSize }}" class="{{ .Class }}"><title>{{ .Title }}</title></rect>
+{{ end }}{{ range .Bytes }}<rect x="{{ .X }}" y="{{ .Y }}" width="{{ $.ByteWidth }}" height="{{ $.CellSize }}" class="byte"><title>{{ .Title }}</title></rect>
+{{ end }}</svg>
+{{ end }}
+{{- with .Invalid }}
+<h2>Block {{ .Block }}: invalid</h2>
+<p>
+Offset {{ .Offset }}: {{ .Reason }}. The following blocks cannot be located.
+</p>
+{{- end }}
+</body>
+</html>
+`))
+
+type legendEntry struct {
+	X, TextX int
+	Class    string
+	Title    string
+}
+
+func legend() ([]legendEntry, int) {
+	entries := []struct{ class, title string }{
+		{"kind", "kind"},
+		{"b", "b"},
+		{"second", "bx / number of exceptions"},
+		{"bitmap-set", "exception bitmap"},
+		{"exception0", "bitpacked exceptions"},
+		{"lane0-0", "256v32 accumulators 0–7"},
+		{"value0", "horizontally bitpacked values"},
+		{"vb0", "variable byte exceptions"},
+		{"index", "exception indexes"},
+		{"constant", "constant value"},
+		{"unused", "unused"},
+	}
+	var l []legendEntry
+	x := 0
+	for _, e := range entries {
+		l = append(l, legendEntry{X: x, TextX: x + 14, Class: e.class, Title: e.title})
+		x += 14 + 7*len(e.title) + 16
+	}
+	return l, x
+}
+
+func main() {
+	flag.Parse()
+	input, n, title, err := source.Load(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Damaged input results in out of range accesses in the decoder, so only
+	// render the blocks before the first invalid block.
+	_, err = goturbopfor.Validate(input, n)
+	ferr, _ := err.(*goturbopfor.FormatError)
+	valid := n
+	if ferr != nil && ferr.Block*256 < n {
+		valid = ferr.Block * 256
+	}
+	padded := make([]byte, len(input)+32)
+	copy(padded, input)
+	infos := goturbopfor.P4nblocks256v32(padded, valid)
+
+	var views []blockView
+	for i := *first; i < len(infos) && i < *first+*blocks; i++ {
+		info := infos[i]
+		views = append(views, render(i, info, padded[info.Offset:info.Offset+info.Size]))
+	}
+	l, legendWidth := legend()
+	if err := page.Execute(os.Stdout, struct {
+		Title       string
+		Values      int
+		Size        int
+		NumBlocks   int
+		LaneStyles  template.CSS
+		Legend      []legendEntry
+		LegendWidth int
+		CellSize    int
+		ByteWidth   int
+		Blocks      []blockView
+		Invalid     *goturbopfor.FormatError
+	}{
+		Title:       title,
+		Values:      n,
+		Size:        len(input),
+		NumBlocks:   len(infos),
+		LaneStyles:  laneStyles(),
+		Legend:      l,
+		LegendWidth: legendWidth,
+		CellSize:    cellSize,
+		ByteWidth:   8 * cellSize,
+		Blocks:      views,
+		Invalid:     ferr,
+	}); err != nil {
+		log.Fatal(err)
+	}
+	if ferr != nil {
+		log.Fatal(ferr)
+	}
+}
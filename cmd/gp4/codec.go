@@ -0,0 +1,109 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/stapelberg/goturbopfor"
+)
+
+func deltaEncode(values []uint32) {
+	var prev uint32
+	for i, v := range values {
+		values[i], prev = v-prev, v
+	}
+}
+
+func deltaDecode(values []uint32) {
+	var prev uint32
+	for i, v := range values {
+		values[i] = prev + v
+		prev = values[i]
+	}
+}
+
+func encodeValues(values []uint32, o *options) []byte {
+	switch o.codec {
+	case "raw":
+		encoded := make([]byte, 4*len(values))
+		for i, v := range values {
+			binary.LittleEndian.PutUint32(encoded[4*i:], v)
+		}
+		return encoded
+
+	case "bitf":
+		encoded := make([]byte, goturbopfor.Bitfnbound32(len(values)))
+		return encoded[:goturbopfor.Bitfnenc32(values, encoded)]
+
+	default: // p4
+		if o.blockSize == 128 {
+			encoded := make([]byte, goturbopfor.P4nbound32(len(values)))
+			return encoded[:goturbopfor.P4nenc32(values, encoded)]
+		}
+		encoded := make([]byte, goturbopfor.P4nbound256v32(len(values)))
+		return encoded[:goturbopfor.P4nenc256v32(values, encoded)]
+	}
+}
+
+func decodeValues(encoded []byte, o *options) (values []uint32, read int, _ error) {
+	// TurboPFor decoders read up to 32 bytes past the end of their input.
+	padded := make([]byte, len(encoded)+32)
+	copy(padded, encoded)
+	switch o.codec {
+	case "raw":
+		if len(encoded)%4 != 0 {
+			return nil, 0, fmt.Errorf("input length %d is not a multiple of 4", len(encoded))
+		}
+		if o.n < 0 {
+			o.n = len(encoded) / 4
+		}
+		if 4*o.n > len(encoded) {
+			return nil, 0, fmt.Errorf("-n=%d requires %d bytes, but the input has %d bytes", o.n, 4*o.n, len(encoded))
+		}
+		values = make([]uint32, o.n)
+		for i := range values {
+			values[i] = binary.LittleEndian.Uint32(encoded[4*i:])
+		}
+		return values, 4 * o.n, nil
+
+	case "bitf":
+		if len(encoded) < 5 {
+			return nil, 0, fmt.Errorf("input too short for -codec=bitf")
+		}
+		b := encoded[4]
+		if need := 5 + (o.n*int(b)+7)/8; b > 32 || need > len(encoded) {
+			return nil, 0, fmt.Errorf("-n=%d values of %d bits do not fit into %d bytes", o.n, b, len(encoded))
+		}
+		values = make([]uint32, o.n)
+		return values, goturbopfor.Bitfndec32(padded, values), nil
+
+	default: // p4
+		validate, decode := goturbopfor.Validate, goturbopfor.P4ndec256v32
+		if o.blockSize == 128 {
+			validate, decode = goturbopfor.Validate32, goturbopfor.P4ndec32
+		}
+		// Corrupt input (or a wrong -n) results in out of range accesses in
+		// the decoder. Bytes after the last block only result in a warning.
+		if consumed, err := validate(encoded, o.n); err != nil {
+			if _, perr := validate(encoded[:consumed], o.n); perr != nil {
+				return nil, 0, err
+			}
+		}
+		values = make([]uint32, o.n)
+		return values, decode(padded, values), nil
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gp4 converts between uncompressed uint32 lists and their encoded form, e.g.
+// to create new test cases:
+//
+//	seq 1 1000 | gp4 encode -text -delta > testdata/seq.input
+//	gp4 decode -n 1000 < testdata/seq.input > testdata/seq.want
+//	gp4 decode -n 1000 -delta -text < testdata/seq.input
+//
+// Uncompressed lists are little endian uint32s (as in testdata/*.want) or, with
+// -text, one decimal number per line.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+)
+
+type options struct {
+	codec     string
+	blockSize int
+	delta     bool
+	text      bool
+	n         int
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.codec, "codec", "p4", "codec: p4 (TurboPFor), bitf (frame of reference: start value as little endian uint32, number of bits b as byte, bitpacked values) or raw (little endian uint32s)")
+	fs.IntVar(&o.blockSize, "blocksize", 256, "p4 block size: 256 (p4nenc256v32, as in testdata/*.input) or 128 (p4nenc32, horizontal bitpacking)")
+	fs.BoolVar(&o.delta, "delta", false, "encode the differences between consecutive values (for sorted lists)")
+	fs.BoolVar(&o.text, "text", false, "read/write uncompressed values as text, one number per line")
+}
+
+func (o *options) check() error {
+	switch o.codec {
+	case "p4", "bitf", "raw":
+	default:
+		return fmt.Errorf("unknown -codec=%q", o.codec)
+	}
+	if o.blockSize != 256 && o.blockSize != 128 {
+		return fmt.Errorf("unsupported -blocksize=%d", o.blockSize)
+	}
+	return nil
+}
+
+func readValues(r io.Reader, text bool) ([]uint32, error) {
+	if text {
+		var values []uint32
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			v, err := strconv.ParseUint(string(line), 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, uint32(v))
+		}
+		return values, scanner.Err()
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b)%4 != 0 {
+		return nil, fmt.Errorf("input length %d is not a multiple of 4", len(b))
+	}
+	values := make([]uint32, len(b)/4)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return values, nil
+}
+
+func writeValues(w io.Writer, values []uint32, text bool) error {
+	bw := bufio.NewWriter(w)
+	var buf [4]byte
+	for _, v := range values {
+		if text {
+			fmt.Fprintln(bw, v)
+			continue
+		}
+		binary.LittleEndian.PutUint32(buf[:], v)
+		bw.Write(buf[:])
+	}
+	return bw.Flush()
+}
+
+// files returns the input and output files specified by args, defaulting to
+// stdin and stdout.
+func files(args []string) (io.ReadCloser, io.WriteCloser, error) {
+	var r io.ReadCloser = os.Stdin
+	var w io.WriteCloser = os.Stdout
+	if len(args) > 0 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		r = f
+	}
+	if len(args) > 1 && args[1] != "-" {
+		f, err := os.Create(args[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		w = f
+	}
+	return r, w, nil
+}
+
+func encode(args []string) error {
+	fs := flag.NewFlagSet("encode", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gp4 encode [flags] [<input> [<output>]]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := o.check(); err != nil {
+		return err
+	}
+	r, w, err := files(fs.Args())
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	values, err := readValues(r, o.text)
+	if err != nil {
+		return err
+	}
+	if o.delta {
+		deltaEncode(values)
+	}
+	encoded := encodeValues(values, &o)
+	if _, err := w.Write(encoded); err != nil {
+		return err
+	}
+	log.Printf("encoded %d values into %d bytes", len(values), len(encoded))
+	return w.Close()
+}
+
+func decode(args []string) error {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	fs.IntVar(&o.n, "n", -1, "number of encoded values (not required for -codec=raw)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gp4 decode -n <values> [flags] [<input> [<output>]]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := o.check(); err != nil {
+		return err
+	}
+	if o.n < 0 && o.codec != "raw" {
+		return fmt.Errorf("-n is required for -codec=%s", o.codec)
+	}
+	r, w, err := files(fs.Args())
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	encoded, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	values, read, err := decodeValues(encoded, &o)
+	if err != nil {
+		return err
+	}
+	if read != len(encoded) {
+		log.Printf("warning: decoding %d values read %d bytes, but the input has %d bytes", len(values), read, len(encoded))
+	}
+	if o.delta {
+		deltaDecode(values)
+	}
+	if err := writeValues(w, values, o.text); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gp4: ")
+	if len(os.Args) < 2 {
+		log.Fatalf("usage: gp4 encode|decode [flags] [<input> [<output>]]")
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "encode":
+		err = encode(args)
+	case "decode":
+		err = decode(args)
+	default:
+		log.Fatalf("unknown command %q, expected encode or decode", cmd)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"fmt"
+	"io"
+)
+
+// readAhead is the minimum number of bytes which DecodeAt reads at once. It
+// covers most blocks (a block of 256 values with b=8 takes 257 bytes), so that
+// typically, only one read is required per few blocks.
+const readAhead = 4096
+
+// blockReader buffers the bytes of an io.ReaderAt, starting at off.
+type blockReader struct {
+	r   io.ReaderAt
+	off int64  // offset of buf[0] within r
+	buf []byte // bytes read, but not yet consumed
+
+	// padded holds a copy of the current block, followed by 32 zero bytes for
+	// the decoder to read past its end. It is reused for all blocks.
+	padded []byte
+}
+
+// ensure makes sure that at least n bytes are buffered.
+func (br *blockReader) ensure(n int) error {
+	if len(br.buf) >= n {
+		return nil
+	}
+	want := n - len(br.buf)
+	if want < readAhead {
+		want = readAhead
+	}
+	chunk := make([]byte, want)
+	read, err := br.r.ReadAt(chunk, br.off+int64(len(br.buf)))
+	br.buf = append(br.buf, chunk[:read]...)
+	if len(br.buf) >= n {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// pad returns a copy of the next size bytes, followed by 32 zero bytes.
+func (br *blockReader) pad(size int) []byte {
+	if cap(br.padded) < size+32 {
+		br.padded = make([]byte, size+32)
+	}
+	padded := br.padded[:size+32]
+	copy(padded, br.buf[:size])
+	for i := size; i < len(padded); i++ {
+		padded[i] = 0
+	}
+	return padded
+}
+
+// advance consumes n bytes.
+func (br *blockReader) advance(n int) {
+	br.buf = br.buf[n:]
+	br.off += int64(n)
+}
+
+// blockSize returns the size of the block of n values which starts at the
+// current position, reading only as many bytes as each part of the block header
+// requires to determine the size.
+func (br *blockReader) blockSize(d *decoder[uint32], n int) (int, error) {
+	if err := br.ensure(1); err != nil {
+		return 0, err
+	}
+	blockType, b := header(br.buf[0])
+	switch blockType {
+	case blockConstant:
+		return 1 + (int(b)+7)/8, nil
+
+	case blockBitpacking:
+		return 1 + d.packedLen(n, b), nil
+
+	case blockBitpackingExceptions:
+		// The size depends on the number of exceptions in the bitmap.
+		if err := br.ensure(2 + (n+7)/8); err != nil {
+			return 0, err
+		}
+		return d.p4len(br.buf, n), nil
+
+	default: // blockBitpackingVBExceptions
+		// The size depends on the variable byte encoded exceptions.
+		pos := 2 + d.packedLen(n, b)
+		if err := br.ensure(pos + 1); err != nil {
+			return 0, err
+		}
+		nex := int(br.buf[1])
+		if br.buf[pos] == 0xff {
+			return pos + 1 + 4*nex + nex, nil // overflow
+		}
+		for i := 0; i < nex; i++ {
+			if err := br.ensure(pos + 1); err != nil {
+				return 0, err
+			}
+			pos += vblen1(br.buf[pos])
+		}
+		return pos + nex, nil
+	}
+}
+
+// DecodeAt is like P4ndec256v32, but reads the encoded data starting at off
+// from r, filling the first n values of out. Only as many bytes as the block
+// headers require are read (with a small read-ahead buffer), and no bytes
+// after the encoded data are required.
+//
+// Each block is checked like Validate does before decoding it. Invalid blocks
+// result in a *FormatError whose Offset is relative to off, errors reading from
+// r are returned as-is (io.ErrUnexpectedEOF if r ends within a block).
+func DecodeAt(r io.ReaderAt, off int64, n int, out []uint32) (read int, err error) {
+	if n < 0 || n > len(out) {
+		return 0, fmt.Errorf("goturbopfor: DecodeAt: n=%d out of range [0, %d]", n, len(out))
+	}
+	br := &blockReader{r: r, off: off}
+	output := out[:n]
+	for block := 0; len(output) > 0; block++ {
+		d := &v256
+		values := 256
+		if len(output) < 256 {
+			d = &remainder
+			values = len(output)
+		}
+		size, err := br.blockSize(d, values)
+		if err != nil {
+			return read, err
+		}
+		if err := br.ensure(size); err != nil {
+			return read, err
+		}
+		// Invalid blocks result in out of range accesses in the decoder.
+		if _, reason := validate32(d, br.buf[:size], values); reason != "" {
+			return read, &FormatError{Block: block, Offset: read, Reason: reason}
+		}
+		if got := d.p4dec(br.pad(size), output[:values]); got != size {
+			return read, &FormatError{
+				Block:  block,
+				Offset: read,
+				Reason: fmt.Sprintf("decoded %d bytes, but the block header specifies %d bytes", got, size),
+			}
+		}
+		br.advance(size)
+		read += size
+		output = output[values:]
+	}
+	return read, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// countingReaderAt counts the calls to ReadAt.
+type countingReaderAt struct {
+	r     io.ReaderAt
+	reads int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	c.reads++
+	return c.r.ReadAt(p, off)
+}
+
+func TestDecodeAt(t *testing.T) {
+	input, want := readTestdata(t, "trigram_592137")
+	const prefix = "garbage before the encoded data"
+	r := &countingReaderAt{r: bytes.NewReader(append([]byte(prefix), input...))}
+	output := make([]uint32, len(want)+10)
+	read, err := DecodeAt(r, int64(len(prefix)), len(want), output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := read, len(input); got != want {
+		t.Fatalf("read: got %d, want %d", got, want)
+	}
+	if !reflect.DeepEqual(output[:len(want)], want) {
+		t.Fatalf("decoded values differ")
+	}
+	if max := len(input)/readAhead + 1; r.reads > max {
+		t.Errorf("DecodeAt called ReadAt %d times, want at most %d", r.reads, max)
+	}
+}
+
+func TestDecodeAtTruncated(t *testing.T) {
+	input, want := readTestdata(t, "trigram_592137")
+	for _, size := range []int{0, 1, 50, len(input) / 2, len(input) - 1} {
+		output := make([]uint32, len(want))
+		_, err := DecodeAt(bytes.NewReader(input[:size]), 0, len(want), output)
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("DecodeAt(%d of %d bytes): got %v, want %v", size, len(input), err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestDecodeAtInvalid(t *testing.T) {
+	// A block of 10 values with one variable byte exception at index 200.
+	input := []byte{0x40, 1, 1, 200}
+	output := make([]uint32, 10)
+	_, err := DecodeAt(bytes.NewReader(input), 0, len(output), output)
+	ferr, ok := err.(*FormatError)
+	if !ok {
+		t.Fatalf("DecodeAt: got %v, want a *FormatError", err)
+	}
+	if ferr.Block != 0 || ferr.Offset != 0 {
+		t.Errorf("DecodeAt: got block %d at offset %d, want block 0 at offset 0", ferr.Block, ferr.Offset)
+	}
+
+	if _, err := DecodeAt(bytes.NewReader(input), 0, len(output)+1, output); err == nil {
+		t.Errorf("DecodeAt(n > len(out)) unexpectedly succeeded")
+	}
+}
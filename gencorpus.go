@@ -0,0 +1,73 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build ignore
+// +build ignore
+
+// gencorpus writes synthetic golden files to testdata/: for each distribution
+// (see internal/corpus) and size, synthetic_<distribution>_<size>.want contains
+// the values as little endian uint32s, and synthetic_<distribution>_<size>.input
+// contains them as encoded by P4nenc256v32.
+//
+// As they are written by goturbopfor’s own encoder, these files are regression
+// fixtures: they detect unintended changes to the encoder and decoder, but not
+// incompatibilities with TurboPFor (unlike the trigram_* files, which were
+// encoded by the C implementation). Larger sizes are generated by the tests
+// instead of being checked in.
+//
+// The files are generated deterministically, so re-running gencorpus only
+// changes them when the encoder changes:
+//
+//	go generate
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+
+	"github.com/stapelberg/goturbopfor"
+	"github.com/stapelberg/goturbopfor/internal/corpus"
+)
+
+var sizes = []int{0, 1, 255, 256, 257}
+
+func generate(dir, name string, n int) error {
+	values := corpus.Values(name, n)
+	var want bytes.Buffer
+	if err := binary.Write(&want, binary.LittleEndian, values); err != nil {
+		return err
+	}
+	input := make([]byte, goturbopfor.P4nbound256v32(n))
+	input = input[:goturbopfor.P4nenc256v32(values, input)]
+
+	base := filepath.Join(dir, fmt.Sprintf("synthetic_%s_%d", name, n))
+	if err := ioutil.WriteFile(base+".want", want.Bytes(), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(base+".input", input, 0644)
+}
+
+func main() {
+	for _, name := range corpus.Distributions() {
+		for _, n := range sizes {
+			if err := generate("testdata", name, n); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+// Unsigned is the set of integer types which Decode and Encode support.
+type Unsigned interface {
+	~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// width returns the number of bits of T.
+func width[T Unsigned]() byte {
+	return bits64(uint64(^T(0)))
+}
+
+// bits64 returns the number of bits required to represent v.
+func bits64(v uint64) byte {
+	var b byte
+	for ; v != 0; v >>= 1 {
+		b++
+	}
+	return b
+}
+
+// maxHeaderB is the largest b which fits into the 6 bits of the block header.
+// For 64 bit values which require all 64 bits, there is no bitpacking block
+// without exceptions, and no constant block.
+const maxHeaderB = 63
+
+// codec describes how Decode and Encode handle values of type T.
+type codec[T Unsigned] struct {
+	blockSize int // number of values per block, except for the last block
+
+	full, last       decoder[T] // last is for the last block, if it has < blockSize values
+	fullEnc, lastEnc encoder[T]
+}
+
+// codecOf returns the codec used by Decode and Encode for T: 32 bit values use
+// the same layout as P4ndec256v32 (blocks of 256 values, interleaved into 8
+// accumulators), all other widths use horizontal bitpacking in blocks of 128
+// values like P4ndec32.
+func codecOf[T Unsigned]() *codec[T] {
+	horizontal := decoder[T]{
+		bitunpack:  bitunpackN[T],
+		packedLen:  packedLenHorizontal,
+		horizontal: bitunpackN[T],
+	}
+	horizontalEnc := encoder[T]{
+		bitpack:    bitpackN[T],
+		packedLen:  packedLenHorizontal,
+		horizontal: bitpackN[T],
+	}
+	if width[T]() == 32 {
+		return &codec[T]{
+			blockSize: 256,
+			full: decoder[T]{
+				bitunpack:  bitunpack256v[T],
+				packedLen:  packedLen256v,
+				horizontal: bitunpackN[T],
+			},
+			last: horizontal,
+			fullEnc: encoder[T]{
+				bitpack:    bitpack256v[T],
+				packedLen:  packedLen256v,
+				horizontal: bitpackN[T],
+			},
+			lastEnc: horizontalEnc,
+		}
+	}
+	return &codec[T]{
+		blockSize: 128,
+		full:      horizontal,
+		last:      horizontal,
+		fullEnc:   horizontalEnc,
+		lastEnc:   horizontalEnc,
+	}
+}
+
+// bitunpackN is like bitunpack32, but for up to 64 bits per value.
+func bitunpackN[T Unsigned](input []byte, output []T, nbits byte) (read int) {
+	var pos uint // in bits
+	for i := range output {
+		var v uint64
+		for got := uint(0); got < uint(nbits); {
+			off := pos % 8
+			take := 8 - off // remaining bits of the current byte
+			if rest := uint(nbits) - got; take > rest {
+				take = rest
+			}
+			v |= uint64(input[pos/8]>>off&(1<<take-1)) << got
+			got += take
+			pos += take
+		}
+		output[i] = T(v)
+	}
+	return int((pos + 7) / 8)
+}
+
+// bitpackN is the inverse of bitunpackN.
+func bitpackN[T Unsigned](input []T, output []byte, nbits byte) (written int) {
+	var pos uint // in bits
+	for _, x := range input {
+		v := uint64(x)
+		for put := uint(0); put < uint(nbits); {
+			off := pos % 8
+			if off == 0 {
+				output[pos/8] = 0
+			}
+			take := 8 - off // remaining bits of the current byte
+			if rest := uint(nbits) - put; take > rest {
+				take = rest
+			}
+			output[pos/8] |= byte(v>>put&(1<<take-1)) << off
+			put += take
+			pos += take
+		}
+	}
+	return int((pos + 7) / 8)
+}
+
+// bitunpack256v calls bitunpack256v32 for 32 bit values.
+func bitunpack256v[T Unsigned](input []byte, output []T, nbits byte) (read int) {
+	var buf [256]uint32
+	read = bitunpack256v32(input, buf[:len(output)], nbits)
+	for i := range output {
+		output[i] = T(buf[i])
+	}
+	return read
+}
+
+// bitpack256v calls bitpack256v32 for 32 bit values.
+func bitpack256v[T Unsigned](input []T, output []byte, nbits byte) (written int) {
+	var buf [256]uint32
+	for i, v := range input {
+		buf[i] = uint32(v)
+	}
+	return bitpack256v32(buf[:len(input)], output, nbits)
+}
+
+// Decode fills out from input, which must have been encoded by Encode for the
+// same width of T. For []uint32, Decode is P4ndec256v32. Like all decoders,
+// Decode reads up to 32 bytes past the end of the encoded data.
+//
+// Only the 32 bit format is compatible with TurboPFor. The formats for uint8,
+// uint16 and uint64 are specific to goturbopfor: they use blocks of 128
+// horizontally bitpacked values, copy overflowing variable byte exceptions with
+// the width of T, and store exceptions which require more than 32 bits in up to
+// 9 bytes (with the number of value bytes minus 3 added to 249, see vbdec).
+func Decode[T Unsigned](input []byte, out []T) (read int) {
+	if out, ok := any(out).([]uint32); ok {
+		return P4ndec256v32(input, out)
+	}
+	c := codecOf[T]()
+	return p4ndec(&c.full, &c.last, c.blockSize, input, out)
+}
+
+// EncodeBound returns the maximum number of bytes Encode writes for n values of
+// type T. Note that decoding requires 32 extra bytes after the encoded data.
+func EncodeBound[T Unsigned](n int) int {
+	blockSize := codecOf[T]().blockSize
+	blocks := (n + blockSize - 1) / blockSize
+	return blocks*(4+blockSize/8) + n*int(width[T]()/8) + (n+7)/8
+}
+
+// Encode writes input to output, which must have room for at least
+// EncodeBound[T](len(input)) bytes. For []uint32, Encode is P4nenc256v32. See
+// Decode for which formats are compatible with TurboPFor.
+func Encode[T Unsigned](input []T, output []byte) (written int) {
+	if input, ok := any(input).([]uint32); ok {
+		return P4nenc256v32(input, output)
+	}
+	c := codecOf[T]()
+	return p4nenc(&c.fullEnc, &c.lastEnc, c.blockSize, input, output)
+}
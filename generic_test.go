@@ -0,0 +1,131 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// docid is a named type, for which Decode and Encode use the generic code
+// paths instead of P4ndec256v32 and P4nenc256v32.
+type docid uint32
+
+func roundtripGeneric[T Unsigned](t *testing.T, input []T) []byte {
+	t.Helper()
+	encoded := make([]byte, EncodeBound[T](len(input))+32)
+	written := Encode(input, encoded)
+	if max := EncodeBound[T](len(input)); written > max {
+		t.Fatalf("Encode wrote %d bytes, EncodeBound is %d", written, max)
+	}
+	output := make([]T, len(input))
+	if got, want := Decode(encoded, output), written; got != want {
+		t.Fatalf("read: got %d, want %d", got, want)
+	}
+	if !reflect.DeepEqual(output, input) {
+		t.Fatalf("got %v, want %v", output, input)
+	}
+	return encoded[:written]
+}
+
+// distributions returns test inputs of n values with at most w bits.
+func distributions(rnd *rand.Rand, n int, w byte) map[string][]uint64 {
+	max := uint64(1)<<w - 1
+	if w == 64 {
+		max = ^uint64(0)
+	}
+	gen := func(f func(i int) uint64) []uint64 {
+		values := make([]uint64, n)
+		for i := range values {
+			values[i] = f(i)
+		}
+		return values
+	}
+	return map[string][]uint64{
+		"zero":     gen(func(int) uint64 { return 0 }),
+		"max":      gen(func(int) uint64 { return max }),
+		"constant": gen(func(int) uint64 { return max / 3 }),
+		"uniform":  gen(func(int) uint64 { return rnd.Uint64() & max }),
+		"small":    gen(func(int) uint64 { return rnd.Uint64() & 7 }),
+		"outliers": gen(func(i int) uint64 {
+			if i%50 == 0 {
+				return max - uint64(i)
+			}
+			return rnd.Uint64() & 15
+		}),
+		"many outliers": gen(func(i int) uint64 {
+			if i%3 == 0 {
+				return rnd.Uint64() & max
+			}
+			return rnd.Uint64() & 3
+		}),
+	}
+}
+
+func convert[T Unsigned](values []uint64) []T {
+	result := make([]T, len(values))
+	for i, v := range values {
+		result[i] = T(v)
+	}
+	return result
+}
+
+func TestGeneric(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 127, 128, 129, 255, 256, 257, 1000} {
+		for name, values := range distributions(rnd, n, 8) {
+			t.Run(fmt.Sprintf("uint8/%s/%d", name, n), func(t *testing.T) {
+				roundtripGeneric(t, convert[uint8](values))
+			})
+		}
+		for name, values := range distributions(rnd, n, 16) {
+			t.Run(fmt.Sprintf("uint16/%s/%d", name, n), func(t *testing.T) {
+				roundtripGeneric(t, convert[uint16](values))
+			})
+		}
+		for name, values := range distributions(rnd, n, 32) {
+			t.Run(fmt.Sprintf("uint32/%s/%d", name, n), func(t *testing.T) {
+				// The generic code path must produce the same bytes as
+				// P4nenc256v32:
+				got := roundtripGeneric(t, convert[docid](values))
+				want := roundtripGeneric(t, convert[uint32](values))
+				if !bytes.Equal(got, want) {
+					t.Fatalf("Encode([]docid) differs from P4nenc256v32")
+				}
+			})
+		}
+		for name, values := range distributions(rnd, n, 64) {
+			t.Run(fmt.Sprintf("uint64/%s/%d", name, n), func(t *testing.T) {
+				roundtripGeneric(t, convert[uint64](values))
+			})
+		}
+	}
+}
+
+func TestDecodeGenericFromFile(t *testing.T) {
+	input, want := readTestdata(t, "trigram_592137")
+	output := make([]docid, len(want))
+	if got, want := Decode(input, output), len(input); got != want {
+		t.Fatalf("read: got %d, want %d", got, want)
+	}
+	for i, v := range output {
+		if uint32(v) != want[i] {
+			t.Fatalf("value %d: got %d, want %d", i, v, want[i])
+		}
+	}
+}
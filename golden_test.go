@@ -0,0 +1,95 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+//go:generate go run gencorpus.go
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stapelberg/goturbopfor/internal/corpus"
+)
+
+// brokenTestdata are files in testdata/ which cannot be decoded.
+var brokenTestdata = map[string]string{
+	"trigram_2":  "stub: empty .input",
+	"trigram_15": ".input is truncated and does not match .want",
+}
+
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/*.input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range inputs {
+		name := strings.TrimSuffix(filepath.Base(fn), ".input")
+		t.Run(name, func(t *testing.T) {
+			if reason, ok := brokenTestdata[name]; ok {
+				t.Skip(reason)
+			}
+			if _, err := os.Stat("testdata/" + name + ".want"); os.IsNotExist(err) {
+				t.Skip("no .want file")
+			}
+			input, want := readTestdata(t, name)
+			output := make([]uint32, len(want))
+			if got, want := P4ndec256v32(input, output), len(input); got != want {
+				t.Fatalf("read: got %d, want %d", got, want)
+			}
+			if !reflect.DeepEqual(output, want) {
+				t.Fatalf("decoded values differ")
+			}
+
+			if strings.HasPrefix(name, "synthetic_") {
+				// Synthetic files are regression fixtures encoded by
+				// P4nenc256v32 (see gencorpus.go), which must still produce
+				// the same bytes:
+				encoded := make([]byte, P4nbound256v32(len(want)))
+				encoded = encoded[:P4nenc256v32(want, encoded)]
+				if !bytes.Equal(encoded, input) {
+					t.Fatalf("P4nenc256v32 output differs from %s (re-run go generate if the encoder changed intentionally)", fn)
+				}
+			}
+		})
+	}
+}
+
+// TestSyntheticLarge checks lists of the synthetic distributions which are too
+// large to check in. Without golden files, it checks that the lists round-trip
+// through P4nenc256v32, Validate and P4ndec256v32.
+func TestSyntheticLarge(t *testing.T) {
+	const n = 100000
+	for _, name := range corpus.Distributions() {
+		t.Run(name, func(t *testing.T) {
+			want := corpus.Values(name, n)
+			encoded := make([]byte, P4nbound256v32(n)+32)
+			written := P4nenc256v32(want, encoded)
+			if consumed, err := Validate(encoded[:written], n); err != nil || consumed != written {
+				t.Fatalf("Validate = %d, %v; want %d, nil", consumed, err, written)
+			}
+			output := make([]uint32, n)
+			if got := P4ndec256v32(encoded, output); got != written {
+				t.Fatalf("read: got %d, want %d", got, written)
+			}
+			if !reflect.DeepEqual(output, want) {
+				t.Fatalf("decoded values differ")
+			}
+		})
+	}
+}
@@ -32,20 +32,20 @@ import (
 //00001011
 func bitunpack32(input []byte, output []uint32, nbits byte) (read int) {
 	orig := len(input)
-	var rbits byte // remaining bits
-	var acc uint32 // accumulator
+	var rbits uint // remaining bits
+	var acc uint64 // accumulator (wide enough to hold 32+7 bits)
 	for op := 0; op < len(output); {
-		if rbits < nbits {
+		if rbits < uint(nbits) {
 			// shift in one more byte
-			acc |= uint32(input[0]) << rbits
+			acc |= uint64(input[0]) << rbits
 			input = input[1:]
 			rbits += 8
 		}
-		if rbits >= nbits {
-			output[op] = acc & ((1 << nbits) - 1)
+		if rbits >= uint(nbits) {
+			output[op] = uint32(acc & ((1 << nbits) - 1))
 			op++
 			acc >>= nbits
-			rbits -= nbits
+			rbits -= uint(nbits)
 		}
 	}
 	return orig - len(input)
@@ -76,7 +76,7 @@ func bitunpack256v32(input []byte, output []uint32, nbits byte) (read int) {
 	return orig - len(input)
 }
 
-// vbdec32 fills output from input, decoding variable byte uint32s.
+// vbdec fills output from input, decoding variable byte values.
 //
 // The variable byte encoding is similar to:
 // https://sqlite.org/src4/doc/trunk/www/varint.wiki
@@ -91,40 +91,72 @@ func bitunpack256v32(input []byte, output []uint32, nbits byte) (read int) {
 // An overflow marker will be used to signal that encoding the
 // values would be less space-efficient than simply copying them
 // (e.g. if all values require 5 bytes).
-func vbdec32(input []byte, output []uint32) (read int) {
-	before := len(input)
+//
+// For uint64, larger values continue the pattern (up to 9 bytes, with up to 5
+// added to 249). TurboPFor does not define this extension, see Decode.
+func vbdec[T Unsigned](input []byte, output []T) (read int) {
 	if input[0] == 0xff {
 		// overflow, memcpy the data as-is:
-		input = input[1:]
-		for op := 0; op < len(output); op++ {
-			output[op] = binary.LittleEndian.Uint32(input)
-			input = input[4:]
+		size := int(width[T]() / 8)
+		read = 1
+		for op := range output {
+			var buf [8]byte
+			copy(buf[:], input[read:read+size])
+			output[op] = T(binary.LittleEndian.Uint64(buf[:]))
+			read += size
 		}
-		return before - len(input)
+		return read
 	}
-	for op := 0; op < len(output); op++ {
-		x := uint32(input[0])
-		input = input[1:]
+	for op := range output {
+		x := uint64(input[read])
+		read++
 		if x < 177 {
 		} else if x < 241 {
-			x = uint32(input[0]) +
+			x = uint64(input[read]) +
 				((x - 177) << 8) +
 				177
-			input = input[1:]
+			read++
 		} else if x < 249 {
-			x = (uint32(input[0]) << 0) +
-				(uint32(input[1]) << 8) +
+			x = (uint64(input[read]) << 0) +
+				(uint64(input[read+1]) << 8) +
 				((x - 241) << 16) +
 				16561
-			input = input[2:]
+			read += 2
 		} else {
-			_b := x - 249 // _b in [0, 1]
-			x = binary.LittleEndian.Uint32(input) & (((1 << (8 * _b)) << 24) - 1)
-			input = input[3+_b:]
+			size := 3 + int(x-249) // 3 or 4 bytes for uint32
+			var buf [8]byte
+			copy(buf[:], input[read:read+size])
+			x = binary.LittleEndian.Uint64(buf[:])
+			read += size
 		}
-		output[op] = x
+		output[op] = T(x)
+	}
+	return read
+}
+
+// vblen returns the number of bytes vbdec would read for n values.
+func vblen[T Unsigned](input []byte, n int) int {
+	if input[0] == 0xff {
+		return 1 + int(width[T]()/8)*n // overflow marker and the data as-is
+	}
+	read := 0
+	for i := 0; i < n; i++ {
+		read += vblen1(input[read])
+	}
+	return read
+}
+
+// vblen1 returns the number of bytes of the variable byte encoded value
+// starting with x.
+func vblen1(x byte) int {
+	if x < 177 {
+		return 1
+	} else if x < 241 {
+		return 2
+	} else if x < 249 {
+		return 3
 	}
-	return before - len(input)
+	return 4 + int(x-249)
 }
 
 var (
@@ -141,42 +173,103 @@ var (
 	blockConstant = [2]byte{1, 1}
 )
 
-type decoder struct {
-	bitunpack func(input []byte, output []uint32, b byte) int
+// decoder decodes blocks of values of type T.
+type decoder[T Unsigned] struct {
+	bitunpack func(input []byte, output []T, b byte) int
+
+	// packedLen returns the number of bytes bitunpack reads for n values.
+	packedLen func(n int, b byte) int
+
+	// horizontal unpacks the bitpacked exceptions, which always use
+	// horizontal bitpacking.
+	horizontal func(input []byte, output []T, b byte) int
+
+	// observer, if non-nil, is called while decoding. It is only set on
+	// per-call copies of v256 and remainder, see P4ndec256v32Observe.
+	observer Observer
+
+	// offset is the offset of the current block within the stream, for
+	// BlockInfo.Offset.
+	offset int
+}
+
+// packedLen256v returns the number of bytes of n values in the 256v32 layout.
+func packedLen256v(n int, b byte) int {
+	// each of the 8 accumulators is stored in whole uint32s
+	return ((n/8)*int(b) + 31) / 32 * 32
+}
+
+// packedLenHorizontal returns the number of bytes of n horizontally bitpacked
+// values.
+func packedLenHorizontal(n int, b byte) int {
+	return (n*int(b) + 7) / 8
 }
 
 var (
 	// v256 is a decoder which operates on 256 uint32s.
-	v256 = decoder{bitunpack: bitunpack256v32}
+	v256 = decoder[uint32]{
+		bitunpack:  bitunpack256v32,
+		packedLen:  packedLen256v,
+		horizontal: bitunpack32,
+	}
 
 	// remainder is a decoder which handles the remaining (<256) uint32s.
-	remainder = decoder{bitunpack: bitunpack32}
+	remainder = decoder[uint32]{
+		bitunpack:  bitunpack32,
+		packedLen:  packedLenHorizontal,
+		horizontal: bitunpack32,
+	}
 )
 
-// p4dec32 decodes one block of TurboPFor-encoded 32 bit ints
-func (d *decoder) p4dec32(input []byte, output []uint32) (read int) {
+// header splits the block header byte into the block type and b.
+func header(h byte) (blockType [2]byte, b byte) {
+	blockType = [2]byte{
+		(h & 0x80) >> 7, // first bit
+		(h & 0x40) >> 6, // second bit
+	}
+	b = h &^ (0x80 | 0x40) // for bitpacking, b is the number of bits
+	return blockType, b
+}
+
+// uint32s converts values for the Observer, which is only set on uint32
+// decoders.
+func uint32s[T Unsigned](values []T) []uint32 {
+	result := make([]uint32, len(values))
+	for i, v := range values {
+		result[i] = uint32(v)
+	}
+	return result
+}
+
+// p4dec decodes one block of TurboPFor-encoded values
+func (d *decoder[T]) p4dec(input []byte, output []T) (read int) {
 	if len(output) == 0 {
 		return 0
 	}
-	before := len(input)            // for returning read bytes
-	b, input := input[0], input[1:] // block header
-	blockType := [2]byte{
-		(b & 0x80) >> 7, // first bit
-		(b & 0x40) >> 6, // second bit
+	before := len(input) // for returning read bytes
+	if d.observer != nil {
+		info := d.p4info(input, len(output))
+		info.Offset = d.offset
+		d.observer.OnBlock(info)
 	}
-	b &= ^byte(0x80 | 0x40) // for bitpacking, b is the number of bits
+	blockType, b := header(input[0])
+	input = input[1:]
 	switch blockType {
 	case blockConstant:
-		padded := make([]byte, binary.Size(uint32(0)))
-		copy(padded, input)
-		u := binary.LittleEndian.Uint32(padded)
-		if b < 32 {
+		var padded [8]byte
+		size := (int(b) + 7) / 8
+		copy(padded[:], input[:size])
+		u := binary.LittleEndian.Uint64(padded[:])
+		if b < 64 {
 			u &= ((1 << b) - 1)
 		}
+		if d.observer != nil {
+			d.observer.OnConstant(uint32(u))
+		}
 		for i := 0; i < len(output); i++ {
-			output[i] = u
+			output[i] = T(u)
 		}
-		return 1 + (int(b)+7)/8
+		return 1 + size
 
 	case blockBitpacking:
 		return 1 + d.bitunpack(input, output, b)
@@ -194,10 +287,20 @@ func (d *decoder) p4dec32(input []byte, output []uint32) (read int) {
 		}
 		input = input[(n+7)/8:]
 
-		exceptions := make([]uint32, nex)
-		input = input[bitunpack32(input, exceptions, bx):]
+		exceptions := make([]T, nex)
+		input = input[d.horizontal(input, exceptions, bx):]
 		input = input[d.bitunpack(input, output, b):]
 
+		if d.observer != nil {
+			positions := make([]int, 0, nex)
+			for i := 0; i < n; i++ {
+				if exmap[i/8]&(1<<uint(i%8)) != 0 {
+					positions = append(positions, i)
+				}
+			}
+			d.observer.OnExceptions(positions, uint32s(exceptions))
+		}
+
 		for i := 0; i < n; i++ {
 			if exmap[i/8]&(1<<uint(i%8)) != 0 {
 				output[i] += exceptions[0] << b
@@ -211,8 +314,15 @@ func (d *decoder) p4dec32(input []byte, output []uint32) (read int) {
 		nex, input := int(input[0]), input[1:] // number of exceptions
 		input = input[d.bitunpack(input, output, b):]
 
-		exceptions := make([]uint32, nex)
-		input = input[vbdec32(input, exceptions):]
+		exceptions := make([]T, nex)
+		input = input[vbdec(input, exceptions):]
+		if d.observer != nil {
+			positions := make([]int, nex)
+			for i := range positions {
+				positions[i] = int(input[i])
+			}
+			d.observer.OnExceptions(positions, uint32s(exceptions))
+		}
 		for i := 0; i < nex; i++ {
 			output[input[i]] |= exceptions[i] << b
 		}
@@ -220,15 +330,54 @@ func (d *decoder) p4dec32(input []byte, output []uint32) (read int) {
 	}
 }
 
+// p4ndec fills output from input, decoding blockSize values at a time with
+// full, and the last block (if it has fewer values) with last.
+func p4ndec[T Unsigned](full, last *decoder[T], blockSize int, input []byte, output []T) (read int) {
+	for len(output) >= blockSize {
+		full.offset = read
+		read += full.p4dec(input[read:], output[:blockSize])
+		output = output[blockSize:]
+	}
+	last.offset = read
+	return read + last.p4dec(input[read:], output)
+}
+
+// P4dec256v32 decodes one block of len(output) uint32s from input, like
+// P4ndec256v32 does for each block: a block of 256 uint32s uses the 256v32
+// layout, a smaller (last) block uses horizontal bitpacking, see P4dec32.
+// len(output) must not exceed 256.
+func P4dec256v32(input []byte, output []uint32) (read int) {
+	if len(output) > 256 {
+		panic("goturbopfor: P4dec256v32 called with more than 256 values")
+	}
+	if len(output) == 256 {
+		return v256.p4dec(input, output)
+	}
+	return remainder.p4dec(input, output)
+}
+
+// P4dec32 decodes one horizontally bitpacked block of len(output) uint32s from
+// input, like P4ndec32 does for each block. len(output) must not exceed 128.
+func P4dec32(input []byte, output []uint32) (read int) {
+	if len(output) > 128 {
+		panic("goturbopfor: P4dec32 called with more than 128 values")
+	}
+	return remainder.p4dec(input, output)
+}
+
 // P4ndec256v32 fills output from input, decoding 256 uint32s at a time.
 //
 // Note that different decoding algorithms are used for the last block, if that
 // block does not contain 256 uint32s.
 func P4ndec256v32(input []byte, output []uint32) (read int) {
-	before := len(input)
-	for len(output) >= 256 {
-		input = input[v256.p4dec32(input, output[:256]):]
-		output = output[256:]
-	}
-	return before - len(input) + remainder.p4dec32(input, output)
+	full, last := v256, remainder // copies, as p4ndec sets their offset
+	return p4ndec(&full, &last, 256, input, output)
+}
+
+// P4ndec32 fills output from input, decoding 128 uint32s at a time. In contrast
+// to P4ndec256v32, all blocks use horizontal bitpacking, i.e. the algorithm
+// which P4ndec256v32 uses for its last block.
+func P4ndec32(input []byte, output []uint32) (read int) {
+	d := remainder // a copy, as p4ndec sets its offset
+	return p4ndec(&d, &d, 128, input, output)
 }
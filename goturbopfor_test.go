@@ -230,12 +230,12 @@ func TestVbdec32(t *testing.T) {
 			padded := make([]byte, len(test.input)*4)
 			copy(padded, test.input)
 			output := make([]uint32, len(test.want))
-			read := vbdec32(padded, output)
+			read := vbdec(padded, output)
 			if got, want := read, len(test.input); got != want {
-				t.Fatalf("vbdec32 read %d, want %d", got, want)
+				t.Fatalf("vbdec read %d, want %d", got, want)
 			}
 			if got, want := output, test.want; !reflect.DeepEqual(got, want) {
-				t.Fatalf("vbdec32: got %d, want %d", got, want)
+				t.Fatalf("vbdec: got %d, want %d", got, want)
 			}
 		})
 	}
@@ -0,0 +1,290 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package index reads Debian Code Search style posting lists, which consist of
+// a posting.docid.meta file and a posting.docid.turbopfor file.
+//
+// The meta file contains one MetaEntry per trigram, sorted by trigram. The
+// turbopfor file contains the docid deltas of each trigram, encoded with
+// TurboPFor’s p4nenc256v32, at the offset specified in the MetaEntry. Such
+// indexes can be created using Writer.
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/stapelberg/goturbopfor"
+	"github.com/stapelberg/goturbopfor/internal/mmap"
+)
+
+type Trigram uint32
+
+// A MetaEntry specifies the offset (in the corresponding data file) and number
+// of entries for each trigram.
+type MetaEntry struct {
+	Trigram    Trigram
+	Entries    uint32 // number of entries (excluding padding)
+	OffsetData int64  // delta offset within the corresponding .data or .turbopfor file
+}
+
+var encoding = binary.LittleEndian
+
+func (me *MetaEntry) Unmarshal(b []byte) {
+	me.Trigram = Trigram(encoding.Uint32(b))
+	me.Entries = encoding.Uint32(b[4:])
+	me.OffsetData = int64(encoding.Uint64(b[8:]))
+}
+
+// MetaEntrySize is (encoding/binary).Size(&MetaEntry{}), which Go 1.11 does not
+// turn into a compile-time constant yet.
+const MetaEntrySize = 16
+
+// padding is the number of extra bytes which mmap.File.Data contains after
+// the end of the file, as required by TurboPFor.
+const padding = 32
+
+// ErrNotFound is returned by Lookup for trigrams which are not in the index.
+var ErrNotFound = errors.New("index: trigram not found")
+
+// Index is an opened Debian Code Search index.
+type Index struct {
+	meta, data *mmap.File
+	entries    int // number of MetaEntries
+	dataLen    int64
+}
+
+// Access describes how the lists of an index will be read, so that the kernel
+// can read ahead accordingly.
+type Access int
+
+const (
+	// AccessNormal is the default: moderate read-ahead.
+	AccessNormal Access = iota
+
+	// AccessRandom disables read-ahead, e.g. for Lookup of individual
+	// trigrams.
+	AccessRandom
+
+	// AccessSequential enables aggressive read-ahead, e.g. for reading all
+	// lists in the order of All.
+	AccessSequential
+)
+
+func (a Access) advice() mmap.Advice {
+	switch a {
+	case AccessRandom:
+		return mmap.AdviceRandom
+	case AccessSequential:
+		return mmap.AdviceSequential
+	default:
+		return mmap.AdviceNormal
+	}
+}
+
+// Options modify how OpenIndexOptions opens an index.
+type Options struct {
+	// Access is the expected access pattern of the posting.docid.turbopfor
+	// file.
+	Access Access
+}
+
+// OpenIndex opens the posting.docid.meta and posting.docid.turbopfor files in
+// dir. Close must be called to release the resources.
+func OpenIndex(dir string) (*Index, error) {
+	return OpenIndexOptions(dir, Options{})
+}
+
+// OpenIndexOptions is like OpenIndex, but applies opts.
+func OpenIndexOptions(dir string, opts Options) (*Index, error) {
+	data, err := mmap.OpenOptions(filepath.Join(dir, "posting.docid.turbopfor"), mmap.Options{
+		Advice: opts.Access.advice(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	meta, err := mmap.Open(filepath.Join(dir, "posting.docid.meta"))
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	return &Index{
+		meta:    meta,
+		data:    data,
+		entries: int(meta.Size() / MetaEntrySize),
+		dataLen: data.Size(),
+	}, nil
+}
+
+// Close releases the resources of the index.
+func (i *Index) Close() error {
+	err1 := i.meta.Close()
+	err2 := i.data.Close()
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+// Len returns the number of trigrams in the index.
+func (i *Index) Len() int {
+	return i.entries
+}
+
+// Entry returns the n-th MetaEntry, 0 <= n < Len().
+func (i *Index) Entry(n int) MetaEntry {
+	var me MetaEntry
+	me.Unmarshal(i.meta.Data[n*MetaEntrySize:])
+	return me
+}
+
+// bounds returns the offsets at which the data of the n-th MetaEntry starts
+// and ends: at the offset of the next MetaEntry (or the end of the data file,
+// for the last MetaEntry). Corrupt offsets result in an error.
+func (i *Index) bounds(n int) (start, end int64, _ error) {
+	me := i.Entry(n)
+	start, end = me.OffsetData, i.dataLen
+	if n+1 < i.entries {
+		end = i.Entry(n + 1).OffsetData
+	}
+	if start < 0 || start > end || end > i.dataLen {
+		return 0, 0, fmt.Errorf("index: trigram %d: invalid offsets [%d, %d) (data file has %d bytes)", me.Trigram, start, end, i.dataLen)
+	}
+	return start, end, nil
+}
+
+// Encoded returns the TurboPFor-encoded docid deltas of the n-th MetaEntry,
+// bounded by the offset of the next MetaEntry (or the end of the data file, for
+// the last MetaEntry). The returned slice has a
+// capacity of 32 more bytes, which TurboPFor decoders need to over-read.
+func (i *Index) Encoded(n int) ([]byte, error) {
+	start, end, err := i.bounds(n)
+	if err != nil {
+		return nil, err
+	}
+	return i.data.Data[start:end : end+padding], nil
+}
+
+// Prefetch asks the kernel to read the encoded docid deltas of the n-th
+// MetaEntry into the page cache, without waiting for the data to be read.
+func (i *Index) Prefetch(n int) error {
+	start, end, err := i.bounds(n)
+	if err != nil {
+		return err
+	}
+	return i.data.Prefetch(int(start), int(end-start))
+}
+
+// Validate checks the structure of the encoded docid deltas of the n-th
+// MetaEntry without decoding them (see goturbopfor.Validate), so that corrupt
+// lists can be skipped instead of causing out of range accesses in the decoder.
+// As lists are bounded by the offset of the next MetaEntry, bytes after the
+// last block (e.g. the padding at the end of the data file) are allowed.
+func (i *Index) Validate(n int) error {
+	encoded, err := i.Encoded(n)
+	if err != nil {
+		return err
+	}
+	entries := int(i.Entry(n).Entries)
+	consumed, err := goturbopfor.Validate(encoded, entries)
+	if err != nil && consumed < len(encoded) {
+		if _, perr := goturbopfor.Validate(encoded[:consumed], entries); perr == nil {
+			return nil // only bytes after the last block
+		}
+	}
+	return err
+}
+
+// Deltas decodes the docid deltas of the n-th MetaEntry. Corrupt lists result
+// in the error of Validate.
+func (i *Index) Deltas(n int) ([]uint32, error) {
+	if err := i.Validate(n); err != nil {
+		return nil, err
+	}
+	encoded, err := i.Encoded(n)
+	if err != nil {
+		return nil, err
+	}
+	deltas := make([]uint32, i.Entry(n).Entries)
+	goturbopfor.P4ndec256v32(encoded[:cap(encoded)], deltas)
+	return deltas, nil
+}
+
+// Find returns the position of trigram t (for use with Entry, Encoded and
+// Deltas), or ErrNotFound.
+func (i *Index) Find(t Trigram) (int, error) {
+	n := sort.Search(i.entries, func(n int) bool {
+		return Trigram(encoding.Uint32(i.meta.Data[n*MetaEntrySize:])) >= t
+	})
+	if n == i.entries || i.Entry(n).Trigram != t {
+		return 0, ErrNotFound
+	}
+	return n, nil
+}
+
+// Lookup returns the docids of trigram t, or ErrNotFound.
+func (i *Index) Lookup(t Trigram) ([]uint32, error) {
+	n, err := i.Find(t)
+	if err != nil {
+		return nil, err
+	}
+	docids, err := i.Deltas(n)
+	if err != nil {
+		return nil, err
+	}
+	var prev uint32
+	for j, delta := range docids {
+		docids[j] = prev + delta
+		prev = docids[j]
+	}
+	return docids, nil
+}
+
+// Iterator iterates over all MetaEntries of an index, see All.
+type Iterator struct {
+	idx *Index
+	n   int
+}
+
+// All returns an Iterator over all MetaEntries of the index, in trigram order:
+//
+//	for it := idx.All(); it.Next(); {
+//		me := it.Entry()
+//		// …
+//	}
+func (i *Index) All() *Iterator {
+	return &Iterator{idx: i, n: -1}
+}
+
+// Next advances the iterator and reports whether there is a current entry.
+func (it *Iterator) Next() bool {
+	if it.n < it.idx.entries {
+		it.n++
+	}
+	return it.n < it.idx.entries
+}
+
+// Index returns the position of the current entry, for use with Encoded and
+// Deltas.
+func (it *Iterator) Index() int {
+	return it.n
+}
+
+// Entry returns the current entry.
+func (it *Iterator) Entry() MetaEntry {
+	return it.idx.Entry(it.n)
+}
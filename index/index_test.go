@@ -0,0 +1,175 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stapelberg/goturbopfor"
+)
+
+// writeIndex writes an index containing the specified docid lists to dir.
+func writeIndex(t *testing.T, dir string, trigrams []Trigram, docids [][]uint32) {
+	t.Helper()
+	var meta, data []byte
+	for i, t := range trigrams {
+		var b [MetaEntrySize]byte
+		encoding.PutUint32(b[:], uint32(t))
+		encoding.PutUint32(b[4:], uint32(len(docids[i])))
+		encoding.PutUint64(b[8:], uint64(len(data)))
+		meta = append(meta, b[:]...)
+
+		deltas := make([]uint32, len(docids[i]))
+		var prev uint32
+		for j, docid := range docids[i] {
+			deltas[j] = docid - prev
+			prev = docid
+		}
+		encoded := make([]byte, goturbopfor.P4nbound256v32(len(deltas)))
+		data = append(data, encoded[:goturbopfor.P4nenc256v32(deltas, encoded)]...)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "posting.docid.meta"), meta, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "posting.docid.turbopfor"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goturbopfor-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	long := make([]uint32, 1000)
+	for i := range long {
+		long[i] = uint32(3 * i)
+	}
+	trigrams := []Trigram{0x616263, 0x616264, 0x787878}
+	docids := [][]uint32{
+		{1, 5, 9},
+		long,
+		{70000},
+	}
+	writeIndex(t, dir, trigrams, docids)
+
+	for _, access := range []Access{AccessNormal, AccessRandom, AccessSequential} {
+		idx, err := OpenIndexOptions(dir, Options{Access: access})
+		if err != nil {
+			t.Fatalf("OpenIndexOptions(%v): %v", access, err)
+		}
+		testIndex(t, idx, trigrams, docids)
+		if err := idx.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testIndex(t *testing.T, idx *Index, trigrams []Trigram, docids [][]uint32) {
+	t.Helper()
+
+	if got, want := idx.Len(), len(trigrams); got != want {
+		t.Fatalf("Len: got %d, want %d", got, want)
+	}
+
+	for i, tri := range trigrams {
+		if n, err := idx.Find(tri); err != nil || n != i {
+			t.Errorf("Find(%x) = %d, %v; want %d, nil", tri, n, err, i)
+		}
+		got, err := idx.Lookup(tri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := docids[i]; !reflect.DeepEqual(got, want) {
+			t.Errorf("Lookup(%x): got %v, want %v", tri, got, want)
+		}
+	}
+
+	for _, tri := range []Trigram{0, 0x616262, 0x616265, 0xffffff} {
+		if _, err := idx.Lookup(tri); err != ErrNotFound {
+			t.Errorf("Lookup(%x): got %v, want %v", tri, err, ErrNotFound)
+		}
+	}
+
+	var got []Trigram
+	for it := idx.All(); it.Next(); {
+		me := it.Entry()
+		if want := uint32(len(docids[it.Index()])); me.Entries != want {
+			t.Errorf("trigram %x: got %d entries, want %d", me.Trigram, me.Entries, want)
+		}
+		got = append(got, me.Trigram)
+	}
+	if !reflect.DeepEqual(got, trigrams) {
+		t.Fatalf("All: got %x, want %x", got, trigrams)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goturbopfor-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Writer pads the data file, so the last list is followed by 32 bytes.
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tri := range []Trigram{0x616263, 0x616264} {
+		if err := w.Add(tri, []uint32{1, 5, 9 + uint32(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(want ...bool) {
+		t.Helper()
+		idx, err := OpenIndex(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer idx.Close()
+		for n, valid := range want {
+			if err := idx.Validate(n); (err == nil) != valid {
+				t.Errorf("Validate(%d) = %v, want valid=%v", n, err, valid)
+			}
+			if _, err := idx.Deltas(n); (err == nil) != valid {
+				t.Errorf("Deltas(%d) = %v, want valid=%v", n, err, valid)
+			}
+		}
+	}
+	check(true, true)
+
+	// Corrupt the header of the first list (b=63):
+	fn := filepath.Join(dir, "posting.docid.turbopfor")
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] = 0x3f
+	if err := ioutil.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	check(false, true)
+}
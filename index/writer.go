@@ -0,0 +1,115 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/stapelberg/goturbopfor"
+)
+
+// Writer writes the posting.docid.meta and posting.docid.turbopfor files of an
+// index, which can be read using OpenIndex.
+type Writer struct {
+	meta, data   *os.File
+	metaw, dataw *bufio.Writer
+	offset       int64 // current offset in the data file
+	entries      int
+	last         Trigram
+	encoded      []byte // scratch buffer
+}
+
+// NewWriter creates the index files in dir. Close must be called to complete
+// the index.
+func NewWriter(dir string) (*Writer, error) {
+	meta, err := os.Create(filepath.Join(dir, "posting.docid.meta"))
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.Create(filepath.Join(dir, "posting.docid.turbopfor"))
+	if err != nil {
+		meta.Close()
+		return nil, err
+	}
+	return &Writer{
+		meta:  meta,
+		data:  data,
+		metaw: bufio.NewWriter(meta),
+		dataw: bufio.NewWriter(data),
+	}, nil
+}
+
+// Add encodes docids and appends them to the index. Trigrams must be added in
+// ascending order, and docids must be sorted in strictly ascending order, i.e.
+// without duplicates.
+func (w *Writer) Add(t Trigram, docids []uint32) error {
+	if w.entries > 0 && t <= w.last {
+		return fmt.Errorf("index: trigram %x added after %x, but trigrams must be added in ascending order", t, w.last)
+	}
+	deltas := make([]uint32, len(docids))
+	var prev uint32
+	for i, docid := range docids {
+		if i > 0 && docid <= prev {
+			return fmt.Errorf("index: trigram %x: docid %d follows %d, but docids must be strictly ascending", t, docid, prev)
+		}
+		deltas[i] = docid - prev
+		prev = docid
+	}
+	if bound := goturbopfor.P4nbound256v32(len(deltas)); cap(w.encoded) < bound {
+		w.encoded = make([]byte, bound)
+	}
+	encoded := w.encoded[:goturbopfor.P4nenc256v32(deltas, w.encoded[:cap(w.encoded)])]
+
+	var b [MetaEntrySize]byte
+	encoding.PutUint32(b[:], uint32(t))
+	encoding.PutUint32(b[4:], uint32(len(docids)))
+	encoding.PutUint64(b[8:], uint64(w.offset))
+	if _, err := w.metaw.Write(b[:]); err != nil {
+		return err
+	}
+	if _, err := w.dataw.Write(encoded); err != nil {
+		return err
+	}
+	w.offset += int64(len(encoded))
+	w.entries++
+	w.last = t
+	return nil
+}
+
+// Close writes the padding which TurboPFor decoders need to over-read at the
+// end of the data file, and closes both files. Both files are closed even if
+// an error occurs, and the first error is returned.
+func (w *Writer) Close() error {
+	var pad [padding]byte
+	_, err := w.dataw.Write(pad[:])
+	for _, f := range []struct {
+		w *bufio.Writer
+		f *os.File
+	}{
+		{w.metaw, w.meta},
+		{w.dataw, w.data},
+	} {
+		if ferr := f.w.Flush(); err == nil {
+			err = ferr
+		}
+		if cerr := f.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goturbopfor-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	long := make([]uint32, 1000)
+	for i := range long {
+		long[i] = uint32(i * i)
+	}
+	trigrams := []Trigram{0x616263, 0x616264, 0x787878}
+	docids := [][]uint32{
+		{1, 5, 9},
+		long,
+		{70000},
+	}
+
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tri := range trigrams {
+		if err := w.Add(tri, docids[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Add(trigrams[0], nil); err == nil {
+		t.Fatalf("Add(%x) after %x unexpectedly succeeded", trigrams[0], trigrams[len(trigrams)-1])
+	}
+	if err := w.Add(0xffffff, []uint32{3, 2}); err == nil {
+		t.Fatalf("Add with unsorted docids unexpectedly succeeded")
+	}
+	if err := w.Add(0xffffff, []uint32{0, 2, 2}); err == nil {
+		t.Fatalf("Add with duplicate docids unexpectedly succeeded")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the files are identical to what writeIndex writes, plus padding:
+	wantDir := filepath.Join(dir, "want")
+	if err := os.Mkdir(wantDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeIndex(t, wantDir, trigrams, docids)
+	for _, fn := range []string{"posting.docid.meta", "posting.docid.turbopfor"} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := ioutil.ReadFile(filepath.Join(wantDir, fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fn == "posting.docid.turbopfor" {
+			want = append(want, make([]byte, padding)...)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %x, want %x", fn, got, want)
+		}
+	}
+
+	idx, err := OpenIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	for i, tri := range trigrams {
+		got, err := idx.Lookup(tri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := docids[i]; !reflect.DeepEqual(got, want) {
+			t.Errorf("Lookup(%x): got %v, want %v", tri, got, want)
+		}
+	}
+}
+
+func TestWriterCloseError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goturbopfor-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(0x616263, []uint32{1, 5, 9}); err != nil {
+		t.Fatal(err)
+	}
+	// Make flushing the meta file fail:
+	if err := w.meta.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Fatalf("Close unexpectedly succeeded")
+	}
+	// The data file must be closed nevertheless:
+	if err := w.data.Close(); err == nil {
+		t.Fatalf("data file was not closed")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package corpus generates the values of the synthetic golden files in
+// testdata/ (see gencorpus.go), so that tests can also generate sizes which are
+// too large to check in.
+package corpus
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// distributions returns value generators by name. rnd is seeded separately for
+// each list.
+var distributions = map[string]func(rnd *rand.Rand) func() uint32{
+	"uniform": func(rnd *rand.Rand) func() uint32 {
+		return rnd.Uint32
+	},
+	"zipf": func(rnd *rand.Rand) func() uint32 {
+		z := rand.NewZipf(rnd, 1.1, 1, math.MaxUint32)
+		return func() uint32 { return uint32(z.Uint64()) }
+	},
+	"geometric": func(rnd *rand.Rand) func() uint32 {
+		// number of failures before the first success, with p=0.01 (like the
+		// gaps between docids of a trigram occurring in 1% of all files)
+		return func() uint32 {
+			return uint32(math.Floor(math.Log(1-rnd.Float64()) / math.Log(1-0.01)))
+		}
+	},
+	"constant": func(*rand.Rand) func() uint32 {
+		return func() uint32 { return 0x89 }
+	},
+	"zero": func(*rand.Rand) func() uint32 {
+		return func() uint32 { return 0 }
+	},
+	"max": func(*rand.Rand) func() uint32 {
+		return func() uint32 { return math.MaxUint32 }
+	},
+	"outliers": func(rnd *rand.Rand) func() uint32 {
+		// small values with a rare, large outlier
+		return func() uint32 {
+			if rnd.Intn(64) == 0 {
+				return rnd.Uint32()
+			}
+			return uint32(rnd.Intn(16))
+		}
+	},
+}
+
+// Distributions returns the names of all distributions, sorted.
+func Distributions() []string {
+	names := make([]string, 0, len(distributions))
+	for name := range distributions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Values returns n values of the named distribution. The values only depend on
+// name and n.
+func Values(name string, n int) []uint32 {
+	rnd := rand.New(rand.NewSource(int64(n)))
+	next := distributions[name](rnd)
+	values := make([]uint32, n)
+	for i := range values {
+		values[i] = next()
+	}
+	return values
+}
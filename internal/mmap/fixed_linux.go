@@ -0,0 +1,40 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package mmap
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// fixedSupported is true if mmapFixed is implemented.
+const fixedSupported = true
+
+// mmapFixed maps fd over b, which must be page-aligned (e.g. part of an
+// existing mapping), with MAP_FIXED.
+func mmapFixed(fd int, b []byte, prot, flags int) error {
+	_, _, errno := unix.Syscall6(unix.SYS_MMAP,
+		uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)),
+		uintptr(prot), uintptr(flags|unix.MAP_FIXED), uintptr(fd), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
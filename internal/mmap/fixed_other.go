@@ -0,0 +1,28 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux || !(amd64 || arm64)
+// +build !linux !amd64,!arm64
+
+package mmap
+
+import "syscall"
+
+// fixedSupported is true if mmapFixed is implemented. On other platforms, the
+// syscall package provides no way to map a file at a given address.
+const fixedSupported = false
+
+func mmapFixed(fd int, b []byte, prot, flags int) error {
+	return syscall.ENOSYS
+}
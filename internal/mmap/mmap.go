@@ -16,18 +16,87 @@ package mmap
 
 import (
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"syscall"
 
 	"golang.org/x/sys/unix"
 )
 
+var pageSize = os.Getpagesize()
+
+// padding is the number of extra (zero) bytes after the end of the file in
+// File.Data, which TurboPFor decoders need to over-read.
+const padding = 32
+
+// File is a memory-mapped file. If the last page of the file has no room for
+// the padding, an additional page of anonymous memory (which reads as zeros) is
+// mapped after the file. Files which cannot be mapped (e.g. on some FUSE file
+// systems, or on platforms without mmapFixed, if the padding requires an
+// additional page) are read into memory instead, which is logged. Empty files
+// are not mapped.
 type File struct {
+	// Data contains the file contents, followed by 32 zero bytes.
 	Data []byte
-	orig []byte
+	orig []byte // mapped memory, or nil if Data was read into memory
+}
+
+var (
+	_ io.ReaderAt = (*File)(nil)
+	_ io.Closer   = (*File)(nil)
+)
+
+// mmap is a variable so that tests can simulate file systems which do not
+// support mmap.
+var mmap = unix.Mmap
+
+// Advice describes the expected access pattern, see madvise(2).
+type Advice int
+
+const (
+	// AdviceNormal is the default: moderate read-ahead.
+	AdviceNormal Advice = iota
+
+	// AdviceRandom disables read-ahead, e.g. for trigram lookups.
+	AdviceRandom
+
+	// AdviceSequential enables aggressive read-ahead, e.g. for verifying an
+	// entire index.
+	AdviceSequential
+
+	// AdviceWillNeed starts reading the entire file into the page cache.
+	AdviceWillNeed
+)
+
+func (a Advice) madv() int {
+	switch a {
+	case AdviceRandom:
+		return unix.MADV_RANDOM
+	case AdviceSequential:
+		return unix.MADV_SEQUENTIAL
+	case AdviceWillNeed:
+		return unix.MADV_WILLNEED
+	default:
+		return unix.MADV_NORMAL
+	}
+}
+
+// Options modify how OpenOptions maps a file.
+type Options struct {
+	Advice Advice
+
+	// Populate pre-faults the entire mapping (MAP_POPULATE), so that no page
+	// faults occur when accessing it later. Ignored on systems other than
+	// Linux.
+	Populate bool
 }
 
 func Open(path string) (*File, error) {
+	return OpenOptions(path, Options{})
+}
+
+func OpenOptions(path string, opts Options) (*File, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -41,20 +110,112 @@ func Open(path string) (*File, error) {
 	if int64(int(size+4095)) != size+4095 {
 		return nil, fmt.Errorf("%s: too large for mmap", path)
 	}
-	n := int(size) + 32 // 32 extra bytes required by TurboPFor
-	if n == 0 {
-		return &File{}, nil
+	n := int(size) + padding
+	if size == 0 {
+		return &File{Data: make([]byte, padding)}, nil // nothing to map
+	}
+	// Only map the pages containing the file: accessing pages wholly beyond
+	// the end of the file raises SIGBUS. The remainder of the last page reads
+	// as zeros, so it can serve as padding if it is large enough.
+	mapped := (int(size) + pageSize - 1) &^ (pageSize - 1)
+	flags := syscall.MAP_SHARED
+	if opts.Populate {
+		flags |= mapPopulate
+	}
+	var data []byte
+	if n <= mapped {
+		data, err = mmap(int(f.Fd()), 0, mapped, syscall.PROT_READ, flags)
+	} else {
+		data, err = mmapPadded(int(f.Fd()), mapped, flags)
 	}
-	data, err := unix.Mmap(int(f.Fd()), 0, (n+4095)&^4095, syscall.PROT_READ, syscall.MAP_SHARED)
 	if err != nil {
-		return nil, fmt.Errorf("mmap %s: %v", path, err)
+		// Fall back to reading the file into a padded heap buffer.
+		log.Printf("mmap %s: %v, reading it into memory instead", path, err)
+		buf := make([]byte, n)
+		if _, rerr := io.ReadFull(f, buf[:size]); rerr != nil {
+			return nil, fmt.Errorf("mmap %s: %v (fallback: %v)", path, err, rerr)
+		}
+		return &File{Data: buf}, nil
 	}
-	return &File{
+	mf := &File{
 		Data: data[:n],
 		orig: data,
-	}, nil
+	}
+	if opts.Advice != AdviceNormal {
+		if err := mf.Advise(opts.Advice); err != nil {
+			mf.Close()
+			return nil, fmt.Errorf("madvise %s: %v", path, err)
+		}
+	}
+	return mf, nil
+}
+
+// mmapPadded maps the first mapped bytes of fd, followed by one page of
+// anonymous memory for the padding: it reserves the entire range with an
+// anonymous mapping and maps the file over its beginning.
+func mmapPadded(fd, mapped, flags int) ([]byte, error) {
+	reserved, err := mmap(-1, 0, mapped+pageSize, syscall.PROT_READ, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, err
+	}
+	if err := mmapFixed(fd, reserved[:mapped], syscall.PROT_READ, flags); err != nil {
+		unix.Munmap(reserved)
+		return nil, err
+	}
+	return reserved, nil
+}
+
+// Advise sets the expected access pattern for the entire file.
+func (f *File) Advise(a Advice) error {
+	if len(f.orig) == 0 {
+		return nil
+	}
+	return unix.Madvise(f.orig, a.madv())
+}
+
+// Prefetch asks the kernel to read the pages containing Data[off:off+n] into
+// the page cache (MADV_WILLNEED), e.g. for the blocks of a list which is about
+// to be decoded. Prefetch does not wait for the data to be read.
+func (f *File) Prefetch(off, n int) error {
+	if off < 0 || n < 0 || off+n > len(f.Data) {
+		return fmt.Errorf("Prefetch(%d, %d) out of range [0, %d)", off, n, len(f.Data))
+	}
+	if n == 0 || len(f.orig) == 0 {
+		return nil
+	}
+	start := off &^ (pageSize - 1) // madvise requires page alignment
+	end := (off + n + pageSize - 1) &^ (pageSize - 1)
+	if end > len(f.orig) {
+		end = len(f.orig)
+	}
+	return unix.Madvise(f.orig[start:end], unix.MADV_WILLNEED)
+}
+
+// Size returns the size of the file, i.e. len(f.Data) without the padding.
+func (f *File) Size() int64 {
+	return int64(len(f.Data) - padding)
+}
+
+// ReadAt implements io.ReaderAt. The padding is not part of the file.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("ReadAt: negative offset %d", off)
+	}
+	if off >= f.Size() {
+		return 0, io.EOF
+	}
+	n = copy(p, f.Data[off:f.Size()])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
 }
 
 func (f *File) Close() error {
-	return unix.Munmap(f.orig)
+	if f.orig == nil {
+		return nil // read into memory
+	}
+	err := unix.Munmap(f.orig)
+	f.Data, f.orig = nil, nil
+	return err
 }
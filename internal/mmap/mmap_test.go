@@ -0,0 +1,178 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mmap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestOpenOptions(t *testing.T) {
+	f, err := ioutil.TempFile("", "goturbopfor-mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	content := bytes.Repeat([]byte("turbopfor"), 3*pageSize)
+	if _, err := f.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []Options{
+		{},
+		{Advice: AdviceRandom},
+		{Advice: AdviceSequential},
+		{Advice: AdviceWillNeed, Populate: true},
+	} {
+		mf, err := OpenOptions(f.Name(), opts)
+		if err != nil {
+			t.Fatalf("OpenOptions(%+v): %v", opts, err)
+		}
+		if got, want := mf.Data[:len(content)], content; !bytes.Equal(got, want) {
+			t.Fatalf("OpenOptions(%+v): unexpected content", opts)
+		}
+		for _, r := range []struct{ off, n int }{
+			{0, 0},
+			{0, 1},
+			{pageSize + 17, 3 * pageSize},
+			{0, len(mf.Data)},
+		} {
+			if err := mf.Prefetch(r.off, r.n); err != nil {
+				t.Errorf("Prefetch(%d, %d): %v", r.off, r.n, err)
+			}
+		}
+		if err := mf.Prefetch(1, len(mf.Data)); err == nil {
+			t.Errorf("Prefetch beyond the end unexpectedly succeeded")
+		}
+		if err := mf.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writeTemp(t *testing.T, content []byte) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "goturbopfor-mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestReadAt(t *testing.T) {
+	content := []byte("hello world")
+	fn := writeTemp(t, content)
+	defer os.Remove(fn)
+
+	// Simulate a file system which does not support mmap:
+	defer func(orig func(int, int64, int, int, int) ([]byte, error)) { mmap = orig }(mmap)
+	for _, name := range []string{"mmap", "fallback"} {
+		t.Run(name, func(t *testing.T) {
+			if name == "fallback" {
+				mmap = func(int, int64, int, int, int) ([]byte, error) {
+					return nil, syscall.ENODEV
+				}
+			}
+			f, err := Open(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if got, want := f.Size(), int64(len(content)); got != want {
+				t.Fatalf("Size: got %d, want %d", got, want)
+			}
+			if got, want := len(f.Data), len(content)+padding; got != want {
+				t.Fatalf("len(Data): got %d, want %d", got, want)
+			}
+			buf := make([]byte, 5)
+			if n, err := f.ReadAt(buf, 6); n != 5 || err != nil || string(buf) != "world" {
+				t.Fatalf("ReadAt(6) = %d, %v, %q; want 5, nil, %q", n, err, buf[:n], "world")
+			}
+			if n, err := f.ReadAt(buf, 8); n != 3 || err != io.EOF || string(buf[:n]) != "rld" {
+				t.Fatalf("ReadAt(8) = %d, %v, %q; want 3, EOF, %q", n, err, buf[:n], "rld")
+			}
+			if n, err := f.ReadAt(buf, int64(len(content))); n != 0 || err != io.EOF {
+				t.Fatalf("ReadAt(end) = %d, %v; want 0, EOF", n, err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	fn := writeTemp(t, nil)
+	defer os.Remove(fn)
+	f, err := Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.Size(), int64(0); got != want {
+		t.Fatalf("Size: got %d, want %d", got, want)
+	}
+	if got, want := f.Data, make([]byte, padding); !bytes.Equal(got, want) {
+		t.Fatalf("Data: got %x, want %x", got, want)
+	}
+	if err := f.Prefetch(0, padding); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// TestPadding checks that the padding can be read for files whose padding
+// would extend into a page beyond the end of the file, which raises SIGBUS
+// when mapped.
+func TestPadding(t *testing.T) {
+	for _, size := range []int{1, pageSize - padding, pageSize - padding + 1, pageSize, 2*pageSize + 100} {
+		content := bytes.Repeat([]byte{0xaa}, size)
+		fn := writeTemp(t, content)
+		defer os.Remove(fn)
+		f, err := Open(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(f.Data), size+padding; got != want {
+			t.Fatalf("size %d: len(Data): got %d, want %d", size, got, want)
+		}
+		if !bytes.Equal(f.Data[:size], content) {
+			t.Fatalf("size %d: unexpected content", size)
+		}
+		if got, want := f.Data[size:], make([]byte, padding); !bytes.Equal(got, want) {
+			t.Fatalf("size %d: padding: got %x, want %x", size, got, want)
+		}
+		if fixedSupported && f.orig == nil {
+			t.Errorf("size %d: read into memory instead of mapped", size)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
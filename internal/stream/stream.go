@@ -0,0 +1,84 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stream loads an encoded stream for the gp4-dump and gp4-viz tools,
+// either from a file (e.g. testdata/*.input) or from a Debian Code Search index.
+package stream
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/stapelberg/goturbopfor/index"
+)
+
+// Source specifies which stream to load, see Register.
+type Source struct {
+	N       int    // number of values in the file, or -1
+	Index   string // if non-empty, load Trigram from this index
+	Trigram uint
+}
+
+// Register registers the -n, -idx and -trigram flags, whose help text uses verb
+// to describe what the tool does with the stream (e.g. "dump").
+func (s *Source) Register(fs *flag.FlagSet, verb string) {
+	fs.IntVar(&s.N, "n", -1, "number of values encoded in the file. If -1, the size of the corresponding .want file is used")
+	fs.StringVar(&s.Index, "idx", "", "if non-empty, "+verb+" -trigram from this Debian Code Search index instead of a file")
+	fs.UintVar(&s.Trigram, "trigram", 0, "trigram to "+verb+" with -idx")
+}
+
+// Load returns the encoded stream (without padding), the number of values it
+// contains and a title describing where it was loaded from. args are the
+// non-flag arguments, which must name the file unless s.Index is set.
+func (s *Source) Load(args []string) (encoded []byte, n int, title string, _ error) {
+	if s.Index != "" {
+		ix, err := index.OpenIndexOptions(s.Index, index.Options{Access: index.AccessRandom})
+		if err != nil {
+			return nil, 0, "", err
+		}
+		defer ix.Close()
+		pos, err := ix.Find(index.Trigram(s.Trigram))
+		if err != nil {
+			return nil, 0, "", err
+		}
+		encoded, err := ix.Encoded(pos)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		title := fmt.Sprintf("trigram %d in %s", s.Trigram, s.Index)
+		// Copy the stream, as it is unmapped when closing the index.
+		return append([]byte(nil), encoded...), int(ix.Entry(pos).Entries), title, nil
+	}
+
+	if len(args) != 1 {
+		return nil, 0, "", fmt.Errorf("usage: %v [-n <values>] <file>", os.Args[0])
+	}
+	fn := args[0]
+	input, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	n = s.N
+	if n == -1 {
+		st, err := os.Stat(strings.TrimSuffix(fn, ".input") + ".want")
+		if err != nil {
+			return nil, 0, "", fmt.Errorf("-n not specified: %v", err)
+		}
+		n = int(st.Size() / 4)
+	}
+	return input, n, fn, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrNoChecksum is returned by DecodeListLenient for lists without
+// FlagChecksum: without the checksum trailer, which stores the length of every
+// group of blocks, damaged blocks cannot be skipped.
+var ErrNoChecksum = errors.New("goturbopfor: list has no checksums, damaged blocks cannot be skipped")
+
+// ValueRange is a range of value indexes, from Start to End (exclusive).
+type ValueRange struct {
+	Start, End int
+}
+
+// decodeGroup decodes the blocks of g from payload (which must be followed by
+// 32 bytes of padding) into output, or returns ErrCorrupt if the blocks are not
+// valid.
+func decodeGroup(payload []byte, g checksumGroup, output []uint32, codec Codec) error {
+	group := payload[g.offset : g.offset+g.length]
+	switch codec {
+	case CodecRaw:
+		if len(group) != 4*len(output) {
+			return ErrCorrupt
+		}
+		for i := range output {
+			output[i] = binary.LittleEndian.Uint32(group[4*i:])
+		}
+
+	case CodecP4nenc256v32:
+		if _, err := Validate(group, len(output)); err != nil {
+			return ErrCorrupt
+		}
+		P4ndec256v32(payload[g.offset:], output)
+
+	default: // CodecBitfpack32
+		// The smallest value and b are stored in the first group.
+		start := binary.LittleEndian.Uint32(payload)
+		b := payload[4]
+		if g.firstBlock == 0 {
+			group = group[5:]
+		}
+		if b > 32 || len(group) != (len(output)*int(b)+7)/8 {
+			return ErrCorrupt
+		}
+		Bitfunpack32(payload[g.offset+g.length-len(group):], output, start, b)
+	}
+	return nil
+}
+
+// DecodeListLenient is like DecodeList, but for lists with checksums (see
+// EncodeListChecksum), it skips groups of blocks which fail their checksum or
+// validation instead of returning an error, and continues with the next group.
+// Missing values are set to 0, and their ranges are returned in missing.
+//
+// For lists with FlagDelta, all values following the first missing value are
+// missing, too, as they are stored relative to their predecessors.
+//
+// Values are recovered per group of blocks: one damaged block makes all values
+// of its group missing, so recovering individual blocks requires
+// blocksPerChecksum=1 (see EncodeListChecksum).
+//
+// For CodecBitfpack32, a damaged first group makes all values missing, because
+// it contains the smallest value and the number of bits per value.
+//
+// A damaged checksum trailer results in ErrTrailerChecksum, because the groups
+// cannot be located without it.
+func DecodeListLenient(input []byte) (values []uint32, missing []ValueRange, err error) {
+	h, err := ParseListHeader(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	if h.Flags&FlagChecksum == 0 {
+		return nil, nil, ErrNoChecksum
+	}
+	input = input[ListHeaderSize:]
+	if h.Length > len(input) {
+		return nil, nil, ErrCorrupt
+	}
+	// Copy the payload so that the decoder can read past its end.
+	payload := make([]byte, h.Length+32)
+	copy(payload, input[:h.Length])
+	groups, err := parseTrailer(input[h.Length:], h)
+	if err != nil {
+		return nil, nil, err
+	}
+	if h.Codec == CodecBitfpack32 && len(groups) > 0 {
+		if err := groups[0].verify(payload); err != nil {
+			return nil, nil, ChecksumErrors{err}
+		}
+	}
+	if err := h.checkLength(payload); err != nil {
+		return nil, nil, err
+	}
+
+	values = make([]uint32, h.Count)
+	for _, g := range groups {
+		r := ValueRange{Start: 256 * g.firstBlock, End: 256 * (g.lastBlock + 1)}
+		if r.End > h.Count {
+			r.End = h.Count
+		}
+		if g.verify(payload) == nil && decodeGroup(payload, g, values[r.Start:r.End], h.Codec) == nil {
+			continue
+		}
+		for i := r.Start; i < r.End; i++ {
+			values[i] = 0 // the decoder might have written some values
+		}
+		if n := len(missing); n > 0 && missing[n-1].End == r.Start {
+			missing[n-1].End = r.End // merge adjacent ranges
+		} else {
+			missing = append(missing, r)
+		}
+	}
+
+	untransform(values, h.Flags)
+	if h.Flags&FlagDelta != 0 && len(missing) > 0 {
+		missing = []ValueRange{{Start: missing[0].Start, End: h.Count}}
+	}
+	for _, r := range missing {
+		for i := r.Start; i < r.End; i++ {
+			values[i] = 0
+		}
+	}
+	return values, missing, nil
+}
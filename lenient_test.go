@@ -0,0 +1,88 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeListLenient(t *testing.T) {
+	_, want := readTestdata(t, "trigram_592137")
+	want = want[:10*256+17]
+	// flip a bit in the middle of the payload bytes of the given groups (of 2
+	// blocks each)
+	damage := func(encoded []byte, h ListHeader, groups ...int) {
+		trailer, err := parseTrailer(encoded[ListHeaderSize+h.Length:], h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range groups {
+			g := trailer[i]
+			encoded[ListHeaderSize+g.offset+g.length/2] ^= 0x10
+		}
+	}
+	for _, test := range []struct {
+		name    string
+		codec   Codec
+		flags   ListFlag
+		groups  []int // to damage
+		missing []ValueRange
+	}{
+		{"undamaged", CodecP4nenc256v32, 0, nil, nil},
+		{"p4", CodecP4nenc256v32, 0, []int{1}, []ValueRange{{512, 1024}}},
+		{"p4 adjacent", CodecP4nenc256v32, 0, []int{1, 2, 4}, []ValueRange{{512, 1536}, {2048, 2560}}},
+		{"raw", CodecRaw, 0, []int{0, 3}, []ValueRange{{0, 512}, {1536, 2048}}},
+		{"bitf", CodecBitfpack32, 0, []int{2}, []ValueRange{{1024, 1536}}},
+		{"zigzag", CodecP4nenc256v32, FlagZigZag, []int{1}, []ValueRange{{512, 1024}}},
+		{"delta", CodecP4nenc256v32, FlagDelta, []int{1}, []ValueRange{{512, 2577}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := EncodeListChecksum(want, test.codec, test.flags, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, err := ParseListHeader(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			damage(encoded, h, test.groups...)
+			values, missing, err := DecodeListLenient(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(missing, test.missing) {
+				t.Fatalf("missing: got %v, want %v", missing, test.missing)
+			}
+			expected := append([]uint32(nil), want...)
+			for _, r := range test.missing {
+				for i := r.Start; i < r.End; i++ {
+					expected[i] = 0
+				}
+			}
+			if !reflect.DeepEqual(values, expected) {
+				t.Fatalf("values differ")
+			}
+		})
+	}
+
+	encoded, err := EncodeList(want, CodecP4nenc256v32, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := DecodeListLenient(encoded); err != ErrNoChecksum {
+		t.Fatalf("DecodeListLenient: got %v, want %v", err, ErrNoChecksum)
+	}
+}
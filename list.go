@@ -0,0 +1,304 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// An encoded list is a self-describing container around encoded values, so that
+// lists can be stored in generic blob stores and still be decoded safely
+// without knowing the number of values or the codec out of band.
+//
+// All fields are little endian:
+//
+//	offset  size  field
+//	     0     4  magic ("GP4L")
+//	     4     1  version (1)
+//	     5     1  codec
+//	     6     2  flags
+//	     8     4  number of values
+//	    12     4  length of the payload in bytes
+//	    16     …  payload
+const (
+	listMagic      = "GP4L"
+	listVersion    = 1
+	ListHeaderSize = 16
+)
+
+// Codec identifies how the payload of an encoded list is encoded.
+type Codec uint8
+
+const (
+	// CodecRaw stores values as uncompressed little endian uint32s.
+	CodecRaw Codec = 1
+
+	// CodecP4nenc256v32 stores values encoded with P4nenc256v32.
+	CodecP4nenc256v32 Codec = 2
+
+	// CodecBitfpack32 stores values encoded with Bitfnenc32.
+	CodecBitfpack32 Codec = 3
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecRaw:
+		return "raw"
+	case CodecP4nenc256v32:
+		return "p4nenc256v32"
+	case CodecBitfpack32:
+		return "bitfpack32"
+	}
+	return "unknown"
+}
+
+func (c Codec) valid() bool {
+	return c >= CodecRaw && c <= CodecBitfpack32
+}
+
+// ListFlag modifies how values are transformed before they are encoded.
+type ListFlag uint16
+
+const (
+	// FlagDelta stores the difference of each value to its predecessor,
+	// which results in small values for sorted lists.
+	FlagDelta ListFlag = 1 << iota
+
+	// FlagZigZag maps values interpreted as int32 to uint32 such that values
+	// of small magnitude stay small, e.g. -1 becomes 1 and 1 becomes 2. This
+	// is useful together with FlagDelta for lists which are not sorted.
+	FlagZigZag
+
+	// FlagChecksum indicates that the payload is followed by checksums, see
+	// EncodeListChecksum.
+	FlagChecksum
+)
+
+// listFlags are all defined flags. Lists with other flags were written by a
+// newer version and cannot be decoded correctly.
+const listFlags = FlagDelta | FlagZigZag | FlagChecksum
+
+var (
+	ErrNotList            = errors.New("goturbopfor: not an encoded list")
+	ErrUnsupportedVersion = errors.New("goturbopfor: unsupported list version")
+	ErrUnknownCodec       = errors.New("goturbopfor: unknown codec")
+	ErrUnknownFlags       = errors.New("goturbopfor: unknown list flags")
+	ErrCorrupt            = errors.New("goturbopfor: corrupt list")
+)
+
+// ListHeader describes an encoded list.
+type ListHeader struct {
+	Codec  Codec
+	Flags  ListFlag
+	Count  int // number of values
+	Length int // length of the payload in bytes
+}
+
+// ParseListHeader reads and checks the header at the beginning of input.
+func ParseListHeader(input []byte) (ListHeader, error) {
+	if len(input) < ListHeaderSize || string(input[:4]) != listMagic {
+		return ListHeader{}, ErrNotList
+	}
+	if input[4] != listVersion {
+		return ListHeader{}, ErrUnsupportedVersion
+	}
+	h := ListHeader{
+		Codec:  Codec(input[5]),
+		Flags:  ListFlag(binary.LittleEndian.Uint16(input[6:])),
+		Count:  int(binary.LittleEndian.Uint32(input[8:])),
+		Length: int(binary.LittleEndian.Uint32(input[12:])),
+	}
+	if !h.Codec.valid() {
+		return ListHeader{}, ErrUnknownCodec
+	}
+	if h.Flags&^listFlags != 0 {
+		return ListHeader{}, ErrUnknownFlags
+	}
+	return h, nil
+}
+
+func (h ListHeader) append(output []byte) []byte {
+	var buf [ListHeaderSize]byte
+	copy(buf[:], listMagic)
+	buf[4] = listVersion
+	buf[5] = byte(h.Codec)
+	binary.LittleEndian.PutUint16(buf[6:], uint16(h.Flags))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(h.Count))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(h.Length))
+	return append(output, buf[:]...)
+}
+
+// transform applies flags to a copy of values.
+func transform(values []uint32, flags ListFlag) []uint32 {
+	result := make([]uint32, len(values))
+	var prev uint32
+	for i, v := range values {
+		if flags&FlagDelta != 0 {
+			v, prev = v-prev, v
+		}
+		if flags&FlagZigZag != 0 {
+			v = uint32(int32(v)<<1) ^ uint32(int32(v)>>31)
+		}
+		result[i] = v
+	}
+	return result
+}
+
+// untransform reverses transform in place.
+func untransform(values []uint32, flags ListFlag) {
+	var prev uint32
+	for i, v := range values {
+		if flags&FlagZigZag != 0 {
+			v = (v >> 1) ^ -(v & 1)
+		}
+		if flags&FlagDelta != 0 {
+			v += prev
+			prev = v
+		}
+		values[i] = v
+	}
+}
+
+func encodePayload(values []uint32, codec Codec) []byte {
+	switch codec {
+	case CodecRaw:
+		payload := make([]byte, 4*len(values))
+		for i, v := range values {
+			binary.LittleEndian.PutUint32(payload[4*i:], v)
+		}
+		return payload
+
+	case CodecP4nenc256v32:
+		payload := make([]byte, P4nbound256v32(len(values)))
+		return payload[:P4nenc256v32(values, payload)]
+
+	default: // CodecBitfpack32
+		payload := make([]byte, Bitfnbound32(len(values)))
+		return payload[:Bitfnenc32(values, payload)]
+	}
+}
+
+// EncodeList encodes values with codec into a self-describing list, applying
+// flags before encoding. Use EncodeListChecksum instead of FlagChecksum.
+func EncodeList(values []uint32, codec Codec, flags ListFlag) ([]byte, error) {
+	if !codec.valid() {
+		return nil, ErrUnknownCodec
+	}
+	if flags&^listFlags != 0 {
+		return nil, ErrUnknownFlags
+	}
+	if flags&FlagChecksum != 0 {
+		return nil, errors.New("goturbopfor: EncodeList does not store checksums, use EncodeListChecksum")
+	}
+	payload := encodePayload(transform(values, flags), codec)
+	h := ListHeader{
+		Codec:  codec,
+		Flags:  flags,
+		Count:  len(values),
+		Length: len(payload),
+	}
+	return append(h.append(make([]byte, 0, ListHeaderSize+len(payload))), payload...), nil
+}
+
+// checkLength verifies that a payload of h.Length bytes can hold h.Count values,
+// so that corrupt headers do not result in huge allocations.
+func (h ListHeader) checkLength(payload []byte) error {
+	switch h.Codec {
+	case CodecRaw:
+		if h.Length != 4*h.Count {
+			return ErrCorrupt
+		}
+
+	case CodecP4nenc256v32:
+		// Every block starts with a header byte.
+		if h.Count > 0 && h.Count > 256*h.Length {
+			return ErrCorrupt
+		}
+
+	case CodecBitfpack32:
+		if h.Length < 5 || payload[4] > 32 ||
+			h.Length != 5+(h.Count*int(payload[4])+7)/8 {
+			return ErrCorrupt
+		}
+	}
+	return nil
+}
+
+// decodePayload decodes payload, which must be followed by 32 bytes of padding.
+func decodePayload(payload []byte, output []uint32, codec Codec) (read int, err error) {
+	switch codec {
+	case CodecRaw:
+		for i := range output {
+			output[i] = binary.LittleEndian.Uint32(payload[4*i:])
+		}
+		return 4 * len(output), nil
+
+	case CodecP4nenc256v32:
+		// Corrupt input can result in out of range accesses in the decoder.
+		if _, err := Validate(payload[:len(payload)-32], len(output)); err != nil {
+			return 0, ErrCorrupt
+		}
+		return P4ndec256v32(payload, output), nil
+
+	default: // CodecBitfpack32
+		return Bitfndec32(payload, output), nil
+	}
+}
+
+// DecodeList decodes a list which was encoded with EncodeList or
+// EncodeListChecksum. For lists with checksums, DecodeList verifies all of them
+// and returns ChecksumErrors naming every damaged group of blocks.
+func DecodeList(input []byte) ([]uint32, error) {
+	h, err := ParseListHeader(input)
+	if err != nil {
+		return nil, err
+	}
+	input = input[ListHeaderSize:]
+	if h.Length > len(input) {
+		return nil, ErrCorrupt
+	}
+	// Copy the payload so that the decoder can read past its end.
+	payload := make([]byte, h.Length+32)
+	copy(payload, input[:h.Length])
+	if h.Flags&FlagChecksum != 0 {
+		groups, err := parseTrailer(input[h.Length:], h)
+		if err != nil {
+			return nil, err
+		}
+		var errs ChecksumErrors
+		for _, g := range groups {
+			if err := g.verify(payload); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			return nil, errs
+		}
+	}
+	if err := h.checkLength(payload); err != nil {
+		return nil, err
+	}
+	values := make([]uint32, h.Count)
+	read, err := decodePayload(payload, values, h.Codec)
+	if err != nil {
+		return nil, err
+	}
+	if read != h.Length {
+		return nil, ErrCorrupt
+	}
+	untransform(values, h.Flags)
+	return values, nil
+}
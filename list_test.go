@@ -0,0 +1,97 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	_, docids := readTestdata(t, "trigram_592137")
+	var prev uint32
+	for i := range docids {
+		docids[i] += prev // the testdata contains deltas
+		prev = docids[i]
+	}
+	unsorted := []uint32{5, 3, 1 << 31, 0, 7, 7, 7}
+	for _, codec := range []Codec{CodecRaw, CodecP4nenc256v32, CodecBitfpack32} {
+		for _, flags := range []ListFlag{0, FlagDelta, FlagZigZag, FlagDelta | FlagZigZag} {
+			for _, values := range [][]uint32{nil, unsorted, docids} {
+				encoded, err := EncodeList(values, codec, flags)
+				if err != nil {
+					t.Fatal(err)
+				}
+				h, err := ParseListHeader(encoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := h, (ListHeader{codec, flags, len(values), len(encoded) - ListHeaderSize}); got != want {
+					t.Fatalf("%v/%v: header: got %+v, want %+v", codec, flags, got, want)
+				}
+				got, err := DecodeList(encoded)
+				if err != nil {
+					t.Fatalf("%v/%v: DecodeList: %v", codec, flags, err)
+				}
+				if len(values) == 0 && len(got) == 0 {
+					continue
+				}
+				if !reflect.DeepEqual(got, values) {
+					t.Fatalf("%v/%v: DecodeList: got %v, want %v", codec, flags, got, values)
+				}
+			}
+		}
+	}
+}
+
+func TestListErrors(t *testing.T) {
+	valid, err := EncodeList([]uint32{1, 2, 3, 400000}, CodecP4nenc256v32, FlagDelta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+	for _, test := range []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"empty", nil, ErrNotList},
+		{"magic", modified(func(b []byte) []byte { b[0] = 'X'; return b }), ErrNotList},
+		{"version", modified(func(b []byte) []byte { b[4] = 2; return b }), ErrUnsupportedVersion},
+		{"codec", modified(func(b []byte) []byte { b[5] = 0; return b }), ErrUnknownCodec},
+		{"flags", modified(func(b []byte) []byte { b[7] = 0x80; return b }), ErrUnknownFlags},
+		{"truncated", valid[:len(valid)-1], ErrCorrupt},
+		{"count", modified(func(b []byte) []byte { b[11] = 0xff; return b }), ErrCorrupt},
+		{"trailing", modified(func(b []byte) []byte { b[8] = 3; return b }), ErrCorrupt},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := DecodeList(test.input); err != test.want {
+				t.Fatalf("DecodeList: got %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	if _, err := EncodeList(nil, Codec(0), 0); err != ErrUnknownCodec {
+		t.Fatalf("EncodeList: got %v, want %v", err, ErrUnknownCodec)
+	}
+	if _, err := EncodeList(nil, CodecRaw, 1<<15); err != ErrUnknownFlags {
+		t.Fatalf("EncodeList: got %v, want %v", err, ErrUnknownFlags)
+	}
+	if _, err := EncodeList(nil, CodecRaw, FlagChecksum); err == nil {
+		t.Fatalf("EncodeList(FlagChecksum) unexpectedly succeeded")
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+// Observer is called by P4ndec256v32Observe while decoding, e.g. for tracing
+// which parts of the format a stream uses, or for following the decoder step by
+// step.
+//
+// The slices passed to Observer methods are only valid for the duration of the
+// call.
+type Observer interface {
+	// OnBlock is called with the block header before each block is decoded.
+	OnBlock(info BlockInfo)
+
+	// OnExceptions is called for BlockBitpackingExceptions and
+	// BlockBitpackingVBExceptions blocks with the positions of the exceptions
+	// within the block and their values, i.e. the bits above info.B.
+	OnExceptions(positions []int, values []uint32)
+
+	// OnConstant is called for BlockConstant blocks with the constant value.
+	OnConstant(value uint32)
+}
+
+// P4ndec256v32Observe is like P4ndec256v32, but calls o while decoding.
+func P4ndec256v32Observe(input []byte, output []uint32, o Observer) (read int) {
+	full, last := v256, remainder // copies, so that concurrent calls do not race
+	full.observer = o
+	last.observer = o
+	return p4ndec(&full, &last, 256, input, output)
+}
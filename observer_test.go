@@ -0,0 +1,115 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"reflect"
+	"testing"
+)
+
+// recorder is an Observer which records all calls.
+type recorder struct {
+	blocks     []BlockInfo
+	exceptions map[int]uint32 // by position within the stream
+	constants  []uint32
+}
+
+func (r *recorder) OnBlock(info BlockInfo) {
+	r.blocks = append(r.blocks, info)
+}
+
+func (r *recorder) OnExceptions(positions []int, values []uint32) {
+	start := 256 * (len(r.blocks) - 1)
+	for i, pos := range positions {
+		r.exceptions[start+pos] = values[i]
+	}
+}
+
+func (r *recorder) OnConstant(value uint32) {
+	r.constants = append(r.constants, value)
+}
+
+func TestObserver(t *testing.T) {
+	input, want := readTestdata(t, "trigram_592137")
+	t.Run("trigram_592137", func(t *testing.T) {
+		testObserver(t, input, want)
+	})
+
+	// trigram_592137 contains no constant blocks, so interleave blocks of
+	// trigram_592137 with constant blocks (including a constant last block):
+	var values []uint32
+	values = append(values, want[:256]...)
+	values = append(values, repeat(42, 256)...)
+	values = append(values, want[256:512]...)
+	values = append(values, repeat(1<<31, 256)...)
+	values = append(values, repeat(7, 100)...)
+	encoded := make([]byte, P4nbound256v32(len(values))+32)
+	encoded = encoded[:P4nenc256v32(values, encoded)]
+	t.Run("constant", func(t *testing.T) {
+		r := testObserver(t, encoded, values)
+		if got, want := r.constants, []uint32{42, 1 << 31, 7}; !reflect.DeepEqual(got, want) {
+			t.Errorf("OnConstant values: got %v, want %v", got, want)
+		}
+	})
+}
+
+func repeat(v uint32, n int) []uint32 {
+	values := make([]uint32, n)
+	for i := range values {
+		values[i] = v
+	}
+	return values
+}
+
+// testObserver decodes input, which contains the values want, and checks that
+// the observer calls match the blocks of input.
+func testObserver(t *testing.T, input []byte, want []uint32) *recorder {
+	padded := make([]byte, len(input)+32)
+	copy(padded, input)
+	r := &recorder{exceptions: make(map[int]uint32)}
+	output := make([]uint32, len(want))
+	if got, want := P4ndec256v32Observe(padded, output, r), len(input); got != want {
+		t.Fatalf("read: got %d, want %d", got, want)
+	}
+	if !reflect.DeepEqual(output, want) {
+		t.Fatalf("decoded values differ")
+	}
+
+	if !reflect.DeepEqual(r.blocks, P4nblocks256v32(padded, len(want))) {
+		t.Fatalf("OnBlock calls differ from P4nblocks256v32")
+	}
+	var constants, exceptions int
+	for _, info := range r.blocks {
+		switch info.Kind {
+		case BlockConstant:
+			constants++
+		case BlockBitpackingExceptions, BlockBitpackingVBExceptions:
+			exceptions += info.Exceptions
+		}
+	}
+	if got, want := len(r.constants), constants; got != want {
+		t.Errorf("OnConstant calls: got %d, want %d", got, want)
+	}
+	if got, want := len(r.exceptions), exceptions; got != want {
+		t.Errorf("exceptions: got %d, want %d", got, want)
+	}
+	for pos, value := range r.exceptions {
+		b := r.blocks[pos/256].B
+		if got, want := value, want[pos]>>b; got != want {
+			t.Errorf("exception at %d: got %d, want %d", pos, got, want)
+		}
+	}
+	return r
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+// EncodeOptions override the choices of the encoder, e.g. to cover every
+// decoder path in tests, regardless of the input.
+type EncodeOptions struct {
+	// ForceKind, if true, makes the encoder use Kind for every block which
+	// Kind can represent. Otherwise, the encoder picks the smallest encoding.
+	ForceKind bool
+	Kind      BlockKind
+
+	// ForceB, if true, makes the encoder use B bits per bitpacked value (or,
+	// for BlockConstant, for the constant value) for every block for which B
+	// is valid.
+	ForceB bool
+	B      byte
+}
+
+// blockTypeOf is the inverse of kindOf.
+func blockTypeOf(kind BlockKind) [2]byte {
+	switch kind {
+	case BlockBitpacking:
+		return blockBitpacking
+	case BlockBitpackingExceptions:
+		return blockBitpackingExceptions
+	case BlockBitpackingVBExceptions:
+		return blockBitpackingVBExceptions
+	default:
+		return blockConstant
+	}
+}
+
+// candidate describes how input would be encoded as a block of blockType with
+// b bits. ok is false if such a block cannot represent input.
+func (e *encoder[T]) candidate(input []T, blockType [2]byte, b byte) (p p4block, ok bool) {
+	if b > width[T]() || b > maxHeaderB {
+		return p4block{}, false
+	}
+	n := len(input)
+	var maxb byte
+	nex := 0 // number of values which do not fit into b bits
+	constant := true
+	for _, v := range input {
+		if vb := bits64(uint64(v)); vb > maxb {
+			maxb = vb
+		}
+		if v>>b != 0 {
+			nex++
+		}
+		if v != input[0] {
+			constant = false
+		}
+	}
+	p = p4block{blockType: blockType, b: b}
+	switch blockType {
+	case blockConstant:
+		if !constant || nex > 0 {
+			return p4block{}, false
+		}
+		p.size = 1 + (int(b)+7)/8
+
+	case blockBitpacking:
+		if nex > 0 {
+			return p4block{}, false
+		}
+		p.size = 1 + e.packedLen(n, b)
+
+	case blockBitpackingExceptions:
+		if maxb > b {
+			p.bx = maxb - b
+		}
+		p.nex = nex
+		p.size = 2 + (n+7)/8 + (nex*int(p.bx)+7)/8 + e.packedLen(n, b)
+
+	default: // blockBitpackingVBExceptions
+		if nex > 255 {
+			return p4block{}, false // the number of exceptions must fit into one byte
+		}
+		vbytes := 0
+		for _, v := range input {
+			if x := uint64(v) >> b; x != 0 {
+				vbytes += vbsize(x)
+			}
+		}
+		if max := 1 + int(width[T]()/8)*nex; vbytes > max {
+			vbytes = max // overflow
+		}
+		p.nex = nex
+		p.size = 2 + e.packedLen(n, b) + vbytes + nex
+	}
+	return p, true
+}
+
+// planOptions is like plan, but picks the smallest encoding among those
+// matching o. If no encoding matches o, plan is used.
+func (e *encoder[T]) planOptions(input []T, o EncodeOptions) p4block {
+	if !o.ForceKind && !o.ForceB {
+		return e.plan(input)
+	}
+	var best p4block
+	found := false
+	for _, kind := range []BlockKind{BlockBitpacking, BlockBitpackingExceptions, BlockBitpackingVBExceptions, BlockConstant} {
+		if o.ForceKind && kind != o.Kind {
+			continue
+		}
+		for b := byte(0); b <= width[T](); b++ {
+			if o.ForceB && b != o.B {
+				continue
+			}
+			p, ok := e.candidate(input, blockTypeOf(kind), b)
+			if ok && (!found || p.size < best.size) {
+				best = p
+				found = true
+			}
+		}
+	}
+	if !found {
+		return e.plan(input)
+	}
+	return best
+}
+
+// P4nbound256v32Options returns the maximum number of bytes
+// P4nenc256v32Options writes for n uint32s: forced encodings can be larger
+// than P4nbound256v32, e.g. when all values become exceptions.
+func P4nbound256v32Options(n int) int {
+	return 4*((n+255)/256) + 9*n
+}
+
+// P4nenc256v32Options is like P4nenc256v32, but encodes the blocks as
+// specified by o. output must have room for at least
+// P4nbound256v32Options(len(input)) bytes.
+func P4nenc256v32Options(input []uint32, output []byte, o EncodeOptions) (written int) {
+	for len(input) >= 256 {
+		written += v256enc.write(input[:256], output[written:], v256enc.planOptions(input[:256], o))
+		input = input[256:]
+	}
+	if len(input) == 0 {
+		return written
+	}
+	return written + remainderEnc.write(input, output[written:], remainderEnc.planOptions(input, o))
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// forcedInput returns n values which a block of kind with b bits can
+// represent.
+func forcedInput(rnd *rand.Rand, kind BlockKind, b byte, n int) []uint32 {
+	values := make([]uint32, n)
+	max := uint64(1)<<b - 1 // largest value which fits into b bits
+	for i := range values {
+		switch kind {
+		case BlockConstant:
+			values[i] = uint32(max)
+		case BlockBitpacking:
+			values[i] = uint32(rnd.Int63n(int64(max) + 1))
+		default:
+			values[i] = uint32(rnd.Int63n(int64(max) + 1))
+			if i%7 == 0 && b < 32 {
+				// exception: set bits above b
+				values[i] |= uint32(rnd.Int63n(1<<(32-b))+1) << b
+			}
+		}
+	}
+	return values
+}
+
+func TestEncodeOptionsMatrix(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, kind := range []BlockKind{BlockBitpacking, BlockBitpackingExceptions, BlockBitpackingVBExceptions, BlockConstant} {
+		for b := byte(0); b <= 32; b++ {
+			for _, n := range []int{256, 100} { // v256 and remainder decoder
+				t.Run(fmt.Sprintf("%v/b=%d/n=%d", kind, b, n), func(t *testing.T) {
+					input := forcedInput(rnd, kind, b, n)
+					o := EncodeOptions{ForceKind: true, Kind: kind, ForceB: true, B: b}
+					encoded := make([]byte, P4nbound256v32Options(n)+32)
+					written := P4nenc256v32Options(input, encoded, o)
+					if got, gotb := header(encoded[0]); kindOf(got) != kind || gotb != b {
+						t.Fatalf("header: got %v, b=%d, want %v, b=%d", kindOf(got), gotb, kind, b)
+					}
+					output := make([]uint32, n)
+					if got, want := P4ndec256v32(encoded, output), written; got != want {
+						t.Fatalf("read: got %d, want %d", got, want)
+					}
+					if !reflect.DeepEqual(output, input) {
+						t.Fatalf("got %v, want %v", output, input)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestEncodeOptionsFallback(t *testing.T) {
+	// A constant block cannot represent these values, so the encoder must
+	// fall back to picking the smallest encoding.
+	input := []uint32{1, 2, 3}
+	o := EncodeOptions{ForceKind: true, Kind: BlockConstant}
+	encoded := make([]byte, P4nbound256v32Options(len(input))+32)
+	written := P4nenc256v32Options(input, encoded, o)
+	if got, want := encoded[:written], roundtrip(t, input); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"encoding/binary"
+)
+
+// vbsize returns the number of bytes vbenc uses for x (without overflow).
+func vbsize(x uint64) int {
+	switch {
+	case x < 177:
+		return 1
+	case x < 16561:
+		return 2
+	case x < 540849:
+		return 3
+	}
+	size := (int(bits64(x)) + 7) / 8
+	if size < 3 {
+		size = 3
+	}
+	return 1 + size
+}
+
+// vbenc is the inverse of vbdec. If the variable byte encoding would take more
+// space than copying the values, the overflow marker is used instead.
+func vbenc[T Unsigned](input []T, output []byte) (written int) {
+	buf := make([]byte, 0, 9*len(input))
+	for _, v := range input {
+		x := uint64(v)
+		switch size := vbsize(x); size {
+		case 1:
+			buf = append(buf, byte(x))
+		case 2:
+			x -= 177
+			buf = append(buf, byte(177+(x>>8)), byte(x))
+		case 3:
+			x -= 16561
+			buf = append(buf, byte(241+(x>>16)), byte(x), byte(x>>8))
+		default:
+			buf = append(buf, byte(249+size-4))
+			for i := 0; i < size-1; i++ {
+				buf = append(buf, byte(x>>(8*uint(i))))
+			}
+		}
+	}
+	size := int(width[T]() / 8)
+	if len(buf) > 1+size*len(input) {
+		// overflow, memcpy the data as-is:
+		output[0] = 0xff
+		written = 1
+		for _, v := range input {
+			var buf [8]byte
+			binary.LittleEndian.PutUint64(buf[:], uint64(v))
+			written += copy(output[written:], buf[:size])
+		}
+		return written
+	}
+	return copy(output, buf)
+}
+
+// encoder encodes blocks of values of type T. It is the inverse of decoder.
+type encoder[T Unsigned] struct {
+	bitpack func(input []T, output []byte, b byte) int
+
+	// packedLen returns the number of bytes bitpack writes for n values.
+	packedLen func(n int, b byte) int
+
+	// horizontal packs the bitpacked exceptions, which always use
+	// horizontal bitpacking.
+	horizontal func(input []T, output []byte, b byte) int
+}
+
+var (
+	// v256enc is an encoder which operates on 256 uint32s.
+	v256enc = encoder[uint32]{
+		bitpack:    bitpack256v32,
+		packedLen:  packedLen256v,
+		horizontal: bitpack32,
+	}
+
+	// remainderEnc is an encoder which handles the remaining (<256) uint32s.
+	remainderEnc = encoder[uint32]{
+		bitpack:    bitpack32,
+		packedLen:  packedLenHorizontal,
+		horizontal: bitpack32,
+	}
+)
+
+// p4block describes how p4enc encodes one block.
+type p4block struct {
+	blockType [2]byte
+	b         byte // number of bits (or, for blockConstant, bits of the value)
+	bx        byte // number of bits of bitpacked exceptions
+	nex       int  // number of exceptions
+	size      int  // number of bytes, including the block header
+}
+
+// plan picks the smallest encoding for input: for every b, the values which
+// do not fit into b bits become exceptions, which are either flagged in a
+// bitmap and bitpacked, or variable byte encoded with their index.
+func (e *encoder[T]) plan(input []T) p4block {
+	n := len(input)
+	constant := true
+	var cnt [65]int // cnt[i] is the number of values requiring i bits
+	for _, v := range input {
+		cnt[bits64(uint64(v))]++
+		if v != input[0] {
+			constant = false
+		}
+	}
+	if b := bits64(uint64(input[0])); constant && b <= maxHeaderB {
+		return p4block{blockType: blockConstant, b: b, size: 1 + (int(b)+7)/8}
+	}
+	maxb := width[T]()
+	for cnt[maxb] == 0 {
+		maxb--
+	}
+	var best p4block // size 0: no candidate yet
+	if maxb <= maxHeaderB {
+		best = p4block{
+			blockType: blockBitpacking,
+			b:         maxb,
+			size:      1 + e.packedLen(n, maxb),
+		}
+	}
+	nex := 0
+	for b := int(maxb) - 1; b >= 0; b-- {
+		nex += cnt[b+1]
+		packed := e.packedLen(n, byte(b))
+
+		bx := maxb - byte(b)
+		if size := 2 + (n+7)/8 + (nex*int(bx)+7)/8 + packed; best.size == 0 || size < best.size {
+			best = p4block{
+				blockType: blockBitpackingExceptions,
+				b:         byte(b),
+				bx:        bx,
+				nex:       nex,
+				size:      size,
+			}
+		}
+
+		if nex > 255 {
+			continue // the number of exceptions must fit into one byte
+		}
+		vbytes := 0
+		for _, v := range input {
+			if x := uint64(v) >> uint(b); x != 0 {
+				vbytes += vbsize(x)
+			}
+		}
+		if max := 1 + int(width[T]()/8)*nex; vbytes > max {
+			vbytes = max // overflow
+		}
+		if size := 2 + packed + vbytes + nex; size < best.size {
+			best = p4block{
+				blockType: blockBitpackingVBExceptions,
+				b:         byte(b),
+				nex:       nex,
+				size:      size,
+			}
+		}
+	}
+	return best
+}
+
+// p4enc encodes one block. It is the inverse of p4dec.
+func (e *encoder[T]) p4enc(input []T, output []byte) (written int) {
+	if len(input) == 0 {
+		return 0
+	}
+	return e.write(input, output, e.plan(input))
+}
+
+// write encodes input as one block, as described by p.
+func (e *encoder[T]) write(input []T, output []byte, p p4block) (written int) {
+	b := p.b
+	switch p.blockType {
+	case blockConstant:
+		output[0] = 0x80 | 0x40 | b
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(input[0]))
+		return 1 + copy(output[1:], buf[:(b+7)/8])
+
+	case blockBitpacking:
+		output[0] = b
+		return 1 + e.bitpack(input, output[1:], b)
+
+	case blockBitpackingExceptions:
+		output[0] = 0x80 | b
+		output[1] = p.bx
+		exmap := output[2 : 2+(len(input)+7)/8]
+		for i := range exmap {
+			exmap[i] = 0
+		}
+		exceptions := make([]T, 0, p.nex)
+		for i, v := range input {
+			if v>>b != 0 {
+				exmap[i/8] |= 1 << uint(i%8)
+				exceptions = append(exceptions, v>>b)
+			}
+		}
+		written = 2 + len(exmap)
+		written += e.horizontal(exceptions, output[written:], p.bx)
+		return written + e.bitpack(input, output[written:], b)
+
+	default: // blockBitpackingVBExceptions
+		output[0] = 0x40 | b
+		output[1] = byte(p.nex)
+		written = 2 + e.bitpack(input, output[2:], b)
+		exceptions := make([]T, 0, p.nex)
+		indexes := make([]byte, 0, p.nex)
+		for i, v := range input {
+			if v>>b != 0 {
+				exceptions = append(exceptions, v>>b)
+				indexes = append(indexes, byte(i))
+			}
+		}
+		written += vbenc(exceptions, output[written:])
+		return written + copy(output[written:], indexes)
+	}
+}
+
+// p4nenc writes input to output, encoding blockSize values at a time with
+// full, and the last block (if it has fewer values) with last.
+func p4nenc[T Unsigned](full, last *encoder[T], blockSize int, input []T, output []byte) (written int) {
+	for len(input) >= blockSize {
+		written += full.p4enc(input[:blockSize], output[written:])
+		input = input[blockSize:]
+	}
+	return written + last.p4enc(input, output[written:])
+}
+
+// P4enc256v32 encodes input as one block, like P4nenc256v32 does for each
+// block. It is the inverse of P4dec256v32. len(input) must not exceed 256, and
+// output must have room for at least P4nbound256v32(len(input)) bytes.
+func P4enc256v32(input []uint32, output []byte) (written int) {
+	if len(input) > 256 {
+		panic("goturbopfor: P4enc256v32 called with more than 256 values")
+	}
+	if len(input) == 256 {
+		return v256enc.p4enc(input, output)
+	}
+	return remainderEnc.p4enc(input, output)
+}
+
+// P4enc32 encodes input as one horizontally bitpacked block, like P4nenc32
+// does for each block. It is the inverse of P4dec32. len(input) must not
+// exceed 128, and output must have room for at least P4nbound32(len(input))
+// bytes.
+func P4enc32(input []uint32, output []byte) (written int) {
+	if len(input) > 128 {
+		panic("goturbopfor: P4enc32 called with more than 128 values")
+	}
+	return remainderEnc.p4enc(input, output)
+}
+
+// P4nbound256v32 returns the maximum number of bytes P4nenc256v32 writes for n
+// uint32s. Note that decoding requires 32 extra bytes after the encoded data.
+func P4nbound256v32(n int) int {
+	return (n+255)/256 + 4*n
+}
+
+// P4nenc256v32 writes input to output, encoding 256 uint32s at a time. output
+// must have room for at least P4nbound256v32(len(input)) bytes.
+//
+// Note that different encoding algorithms are used for the last block, if that
+// block does not contain 256 uint32s.
+func P4nenc256v32(input []uint32, output []byte) (written int) {
+	return p4nenc(&v256enc, &remainderEnc, 256, input, output)
+}
+
+// EstimateP4Size returns the number of bytes P4nenc256v32 writes for values,
+// without encoding them. It makes the same per-block decisions as the encoder,
+// so the result is exact, and it does not allocate.
+func EstimateP4Size(values []uint32) int {
+	size := 0
+	for len(values) >= 256 {
+		size += v256enc.plan(values[:256]).size
+		values = values[256:]
+	}
+	if len(values) > 0 {
+		size += remainderEnc.plan(values).size
+	}
+	return size
+}
+
+// P4nbound32 returns the maximum number of bytes P4nenc32 writes for n uint32s.
+// Note that decoding requires 32 extra bytes after the encoded data.
+func P4nbound32(n int) int {
+	return (n+127)/128 + 4*n
+}
+
+// P4nenc32 writes input to output, encoding 128 uint32s at a time with
+// horizontal bitpacking. output must have room for at least
+// P4nbound32(len(input)) bytes.
+func P4nenc32(input []uint32, output []byte) (written int) {
+	return p4nenc(&remainderEnc, &remainderEnc, 128, input, output)
+}
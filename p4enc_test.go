@@ -0,0 +1,216 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestVbenc32(t *testing.T) {
+	for _, input := range [][]uint32{
+		{0, 176, 177, 16560, 16561, 540848, 540849, 16777215, 16777216, 4294967295},
+		{4294967295, 4294967295, 4294967295}, // overflow
+	} {
+		output := make([]byte, 5*len(input)+32)
+		written := vbenc(input, output)
+		got := make([]uint32, len(input))
+		if read := vbdec(output, got); read != written {
+			t.Fatalf("vbdec read %d, want %d", read, written)
+		}
+		if !reflect.DeepEqual(got, input) {
+			t.Fatalf("vbdec: got %d, want %d", got, input)
+		}
+	}
+}
+
+func roundtrip(t *testing.T, input []uint32) []byte {
+	t.Helper()
+	encoded := make([]byte, P4nbound256v32(len(input))+32)
+	written := P4nenc256v32(input, encoded)
+	output := make([]uint32, len(input))
+	if got, want := P4ndec256v32(encoded, output), written; got != want {
+		t.Fatalf("read: got %d, want %d", got, want)
+	}
+	if !reflect.DeepEqual(output, input) {
+		t.Fatalf("got %v, want %v", output, input)
+	}
+	return encoded[:written]
+}
+
+func TestEncodeFromFile(t *testing.T) {
+	input, want := readTestdata(t, "trigram_592137")
+	encoded := roundtrip(t, want)
+	t.Logf("TurboPFor: %d bytes, goturbopfor: %d bytes", len(input), len(encoded))
+}
+
+func TestP4nenc32(t *testing.T) {
+	_, want := readTestdata(t, "trigram_592137")
+	encoded := make([]byte, P4nbound32(len(want))+32)
+	written := P4nenc32(want, encoded)
+	output := make([]uint32, len(want))
+	if got, want := P4ndec32(encoded, output), written; got != want {
+		t.Fatalf("read: got %d, want %d", got, want)
+	}
+	if !reflect.DeepEqual(output, want) {
+		t.Fatalf("decoded values differ")
+	}
+}
+
+func TestEncodeBlockTypes(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	block := func(f func(i int) uint32) []uint32 {
+		values := make([]uint32, 256+13) // full block and remainder block
+		for i := range values {
+			values[i] = f(i)
+		}
+		return values
+	}
+	for _, test := range []struct {
+		name      string
+		input     []uint32
+		blockType [2]byte
+	}{
+		{
+			name:      "constant",
+			input:     block(func(int) uint32 { return 0x89 }),
+			blockType: blockConstant,
+		},
+
+		{
+			name:      "bitpack only",
+			input:     block(func(int) uint32 { return uint32(rnd.Intn(128)) }),
+			blockType: blockBitpacking,
+		},
+
+		{
+			name: "bitmap exceptions",
+			input: block(func(i int) uint32 {
+				if i%3 == 0 {
+					return uint32(rnd.Intn(1 << 20))
+				}
+				return uint32(rnd.Intn(8))
+			}),
+			blockType: blockBitpackingExceptions,
+		},
+
+		{
+			name: "VB exceptions",
+			input: block(func(i int) uint32 {
+				if i%50 == 0 {
+					return 1 << 31
+				}
+				return uint32(rnd.Intn(8))
+			}),
+			blockType: blockBitpackingVBExceptions,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			encoded := roundtrip(t, test.input)
+			if got, _ := header(encoded[0]); got != test.blockType {
+				t.Fatalf("block type: got %v, want %v", got, test.blockType)
+			}
+		})
+	}
+}
+
+func TestEstimateP4Size(t *testing.T) {
+	_, want := readTestdata(t, "trigram_592137")
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]uint32, 1000)
+	for i := range random {
+		random[i] = rnd.Uint32() >> uint(rnd.Intn(32))
+	}
+	for _, values := range [][]uint32{
+		{},
+		{42},
+		want,
+		want[:256],
+		want[:257],
+		random,
+	} {
+		encoded := roundtrip(t, values)
+		if got, want := EstimateP4Size(values), len(encoded); got != want {
+			t.Errorf("EstimateP4Size(%d values): got %d, want %d", len(values), got, want)
+		}
+	}
+
+	if allocs := testing.AllocsPerRun(10, func() { EstimateP4Size(want) }); allocs != 0 {
+		t.Errorf("EstimateP4Size allocates: got %v allocations, want 0", allocs)
+	}
+}
+
+func BenchmarkEstimateP4Size(b *testing.B) {
+	_, want := readTestdata(b, "trigram_592137")
+	b.SetBytes(int64(4 * len(want)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		EstimateP4Size(want)
+	}
+}
+
+func BenchmarkP4nenc256v32(b *testing.B) {
+	_, want := readTestdata(b, "trigram_592137")
+	buffer := make([]byte, P4nbound256v32(len(want)))
+	b.SetBytes(int64(4 * len(want)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		P4nenc256v32(want, buffer)
+	}
+}
+
+func TestBlockPrimitives(t *testing.T) {
+	_, want := readTestdata(t, "trigram_592137")
+	for _, test := range []struct {
+		name      string
+		blockSize int
+		encn      func(input []uint32, output []byte) int
+		enc       func(input []uint32, output []byte) int
+		dec       func(input []byte, output []uint32) int
+	}{
+		{"256v32", 256, P4nenc256v32, P4enc256v32, P4dec256v32},
+		{"32", 128, P4nenc32, P4enc32, P4dec32},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			values := want[:10*test.blockSize+17] // ends in a partial block
+			stream := make([]byte, P4nbound256v32(len(values)))
+			stream = stream[:test.encn(values, stream)]
+
+			// Encoding block by block must result in the same stream:
+			var blocks []byte
+			for rest := values; len(rest) > 0; {
+				n := test.blockSize
+				if n > len(rest) {
+					n = len(rest)
+				}
+				block := make([]byte, P4nbound256v32(n)+32)
+				written := test.enc(rest[:n], block)
+				output := make([]uint32, n)
+				if got, want := test.dec(block, output), written; got != want {
+					t.Fatalf("read: got %d, want %d", got, want)
+				}
+				if !reflect.DeepEqual(output, rest[:n]) {
+					t.Fatalf("got %v, want %v", output, rest[:n])
+				}
+				blocks = append(blocks, block[:written]...)
+				rest = rest[n:]
+			}
+			if !reflect.DeepEqual(blocks, stream) {
+				t.Fatalf("blocks differ from the stream")
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import "sync"
+
+// P4ndec256v32Parallel is like P4ndec256v32, but splits output into ranges of
+// blocks which are decoded on up to workers goroutines.
+//
+// Where each block starts is only known after reading all previous block
+// headers, so the input is first scanned sequentially. This scan is cheap
+// compared to decoding, as it does not touch the bitpacked values.
+func P4ndec256v32Parallel(input []byte, output []uint32, workers int) (read int) {
+	nblocks := len(output) / 256
+	if workers > nblocks {
+		workers = nblocks
+	}
+	if workers < 2 {
+		return P4ndec256v32(input, output)
+	}
+
+	offsets := make([]int, nblocks+1) // offsets[i] is where block i starts
+	for i := 0; i < nblocks; i++ {
+		offsets[i+1] = offsets[i] + v256.p4len(input[offsets[i]:], 256)
+	}
+
+	var wg sync.WaitGroup
+	perWorker := (nblocks + workers - 1) / workers
+	for first := 0; first < nblocks; first += perWorker {
+		last := first + perWorker
+		if last > nblocks {
+			last = nblocks
+		}
+		wg.Add(1)
+		go func(first, last int) {
+			defer wg.Done()
+			P4ndec256v32(input[offsets[first]:], output[first*256:last*256])
+		}(first, last)
+	}
+	rest := remainder.p4dec(input[offsets[nblocks]:], output[nblocks*256:])
+	wg.Wait()
+	return offsets[nblocks] + rest
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func readTestdata(tb testing.TB, fn string) (input []byte, want []uint32) {
+	wantb, err := ioutil.ReadFile("testdata/" + fn + ".want")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	want = make([]uint32, len(wantb)/4)
+	if err := binary.Read(bytes.NewReader(wantb), binary.LittleEndian, want); err != nil {
+		tb.Fatal(err)
+	}
+	input, err = ioutil.ReadFile("testdata/" + fn + ".input")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	padded := make([]byte, len(input)+32)
+	copy(padded, input)
+	return padded[:len(input)], want
+}
+
+func TestDecodeParallel(t *testing.T) {
+	input, want := readTestdata(t, "trigram_592137")
+	for _, workers := range []int{0, 1, 2, 3, 8, 10000} {
+		buffer := make([]uint32, len(want))
+		if got, want := P4ndec256v32Parallel(input, buffer, workers), len(input); got != want {
+			t.Fatalf("workers=%d: read: got %d, want %d", workers, got, want)
+		}
+		if !reflect.DeepEqual(buffer, want) {
+			t.Fatalf("workers=%d: decoded values differ", workers)
+		}
+	}
+}
+
+func BenchmarkP4ndec256v32(b *testing.B) {
+	input, want := readTestdata(b, "trigram_592137")
+	buffer := make([]uint32, len(want))
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		P4ndec256v32(input, buffer)
+	}
+}
+
+func BenchmarkP4ndec256v32Parallel(b *testing.B) {
+	input, want := readTestdata(b, "trigram_592137")
+	buffer := make([]uint32, len(want))
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		P4ndec256v32Parallel(input, buffer, runtime.NumCPU())
+	}
+}
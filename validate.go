@@ -0,0 +1,200 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A FormatError describes a structural problem found by Validate.
+type FormatError struct {
+	Block  int // index of the invalid block
+	Offset int // offset of the invalid block within the input
+	Reason string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("goturbopfor: invalid block %d at offset %d: %s", e.Block, e.Offset, e.Reason)
+}
+
+// validate32 checks the block of n uint32s at the beginning of input, which d
+// decodes, without reading past the end of input. It returns the size of the
+// block, or a description of the problem.
+func validate32(d *decoder[uint32], input []byte, n int) (size int, reason string) {
+	truncated := func(size int) string {
+		return fmt.Sprintf("block of %d bytes truncated to %d bytes", size, len(input))
+	}
+	if len(input) < 1 {
+		return 0, "truncated block header"
+	}
+	blockType, b := header(input[0])
+	if b > 32 {
+		return 0, fmt.Sprintf("b=%d exceeds 32 bits", b)
+	}
+	switch blockType {
+	case blockConstant:
+		size = 1 + (int(b)+7)/8
+
+	case blockBitpacking:
+		size = 1 + d.packedLen(n, b)
+
+	case blockBitpackingExceptions:
+		bitmapLen := (n + 7) / 8
+		if len(input) < 2+bitmapLen {
+			return 0, truncated(2 + bitmapLen)
+		}
+		bx := input[1]
+		if int(b)+int(bx) > 32 {
+			return 0, fmt.Sprintf("b=%d plus bx=%d exceeds 32 bits", b, bx)
+		}
+		exmap := input[2:]
+		nex := 0 // number of exceptions
+		for i := 0; i < n; i++ {
+			if exmap[i/8]&(1<<uint(i%8)) != 0 {
+				nex++
+			}
+		}
+		size = 2 + bitmapLen + (nex*int(bx)+7)/8 + d.packedLen(n, b)
+
+	default: // blockBitpackingVBExceptions
+		if len(input) < 2 {
+			return 0, "truncated block header"
+		}
+		nex := int(input[1]) // number of exceptions
+		if nex > n {
+			return 0, fmt.Sprintf("%d exceptions in a block of %d values", nex, n)
+		}
+		pos := 2 + d.packedLen(n, b)
+		if len(input) < pos {
+			return 0, truncated(pos)
+		}
+		if pos < len(input) && input[pos] == 0xff {
+			// overflow: the exceptions are stored as-is
+			pos++
+			if len(input) < pos+4*nex {
+				return 0, truncated(pos + 4*nex)
+			}
+			for i := 0; i < nex; i++ {
+				x := binary.LittleEndian.Uint32(input[pos:])
+				if int(b)+int(bits32(x)) > 32 {
+					return 0, fmt.Sprintf("exception %d exceeds 32 bits when shifted by b=%d", i, b)
+				}
+				pos += 4
+			}
+		} else {
+			for i := 0; i < nex; i++ {
+				if len(input) < pos+1 {
+					return 0, truncated(pos + 1)
+				}
+				x := input[pos]
+				if x > 250 {
+					return 0, fmt.Sprintf("invalid variable byte exception %d (first byte %#x)", i, x)
+				}
+				l := vblen1(x)
+				if len(input) < pos+l {
+					return 0, truncated(pos + l)
+				}
+				v := vbvalue(input[pos : pos+l])
+				if int(b)+int(bits32(v)) > 32 {
+					return 0, fmt.Sprintf("exception %d exceeds 32 bits when shifted by b=%d", i, b)
+				}
+				pos += l
+			}
+		}
+		if len(input) < pos+nex {
+			return 0, truncated(pos + nex)
+		}
+		for i, idx := range input[pos : pos+nex] {
+			if int(idx) >= n {
+				return 0, fmt.Sprintf("exception %d at index %d in a block of %d values", i, idx, n)
+			}
+			if i > 0 && idx <= input[pos+i-1] {
+				return 0, fmt.Sprintf("exception indexes not in ascending order (%d after %d)", idx, input[pos+i-1])
+			}
+		}
+		size = pos + nex
+	}
+	if len(input) < size {
+		return 0, truncated(size)
+	}
+	return size, ""
+}
+
+// vbvalue decodes the variable byte encoded value p (see vbdec), which must
+// be exactly vblen1(p[0]) bytes long.
+func vbvalue(p []byte) uint32 {
+	x := uint32(p[0])
+	switch len(p) {
+	case 1:
+		return x
+	case 2:
+		return uint32(p[1]) + ((x - 177) << 8) + 177
+	case 3:
+		return uint32(p[1]) + uint32(p[2])<<8 + ((x - 241) << 16) + 16561
+	case 4:
+		return uint32(p[1]) | uint32(p[2])<<8 | uint32(p[3])<<16
+	default:
+		return uint32(p[1]) | uint32(p[2])<<8 | uint32(p[3])<<16 | uint32(p[4])<<24
+	}
+}
+
+// Validate checks the structure of input, which must contain exactly n uint32s
+// as encoded by P4nenc256v32, without decoding it: bit widths must not exceed
+// 32 bits, exception counts and indexes must fit the block, and the last block
+// must end at len(input). Unlike the decoders, Validate does not require
+// padding after the encoded data.
+//
+// If input is valid, P4ndec256v32 reads consumed == len(input) bytes when
+// decoding it (from a buffer with 32 bytes of padding), without out of range
+// accesses. Otherwise, err is a *FormatError.
+func Validate(input []byte, n int) (consumed int, err error) {
+	return validate(&v256, &remainder, 256, input, n)
+}
+
+// Validate32 is like Validate, but for input as encoded by P4nenc32 (blocks of
+// 128 horizontally bitpacked uint32s), which P4ndec32 decodes.
+func Validate32(input []byte, n int) (consumed int, err error) {
+	return validate(&remainder, &remainder, 128, input, n)
+}
+
+// validate checks input, which contains n uint32s in blocks of blockSize
+// values, decoded with full, and the last block (if it has fewer values) with
+// last.
+func validate(full, last *decoder[uint32], blockSize int, input []byte, n int) (consumed int, err error) {
+	block := 0
+	for ; n > 0; block++ {
+		d := full
+		values := blockSize
+		if n < blockSize {
+			d = last
+			values = n
+		}
+		size, reason := validate32(d, input[consumed:], values)
+		if reason != "" {
+			return consumed, &FormatError{Block: block, Offset: consumed, Reason: reason}
+		}
+		consumed += size
+		n -= values
+	}
+	if consumed != len(input) {
+		return consumed, &FormatError{
+			Block:  block,
+			Offset: consumed,
+			Reason: fmt.Sprintf("%d bytes after the last block", len(input)-consumed),
+		}
+	}
+	return consumed, nil
+}
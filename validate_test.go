@@ -0,0 +1,137 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goturbopfor
+
+import (
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/*.input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range inputs {
+		name := strings.TrimSuffix(filepath.Base(fn), ".input")
+		if _, ok := brokenTestdata[name]; ok {
+			continue
+		}
+		input, want := readTestdata(t, name)
+		if got, err := Validate(input, len(want)); err != nil || got != len(input) {
+			t.Errorf("Validate(%s) = %d, %v, want %d, nil", name, got, err, len(input))
+		}
+	}
+
+	input, want := readTestdata(t, "trigram_15")
+	if _, err := Validate(input, len(want)); err == nil {
+		t.Errorf("Validate(trigram_15) unexpectedly succeeded")
+	}
+}
+
+func TestValidate32(t *testing.T) {
+	_, want := readTestdata(t, "trigram_592137")
+	input := make([]byte, P4nbound32(len(want)))
+	input = input[:P4nenc32(want, input)]
+	if got, err := Validate32(input, len(want)); err != nil || got != len(input) {
+		t.Fatalf("Validate32 = %d, %v, want %d, nil", got, err, len(input))
+	}
+	if _, err := Validate32(input[:len(input)-1], len(want)); err == nil {
+		t.Errorf("Validate32(truncated) unexpectedly succeeded")
+	}
+	// The 256v32 layout of blocks of 256 values differs:
+	if _, err := Validate(input, len(want)); err == nil {
+		t.Errorf("Validate(P4nenc32 output) unexpectedly succeeded")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		input []byte
+		n     int
+		want  string // substring of the FormatError reason, or empty if valid
+	}{
+		{"bitpack only", []byte{0x07, 0xaa, 0x9c, 0xf6, 0x0e}, 4, ""},
+		{"constant", []byte{0xc8, 0x89}, 1, ""},
+		{"VB exceptions", []byte{0x44, 0x1, 0x97, 0x43, 0x15, 0x73, 0x13, 0xe2, 0xf, 0xb}, 12, ""},
+		{"bitmap exceptions", []byte{0x84, 0x1a, 0x0, 0x8, 0x2c, 0xf7, 0xac, 0x2, 0x97, 0x43, 0x15, 0x73, 0x13, 0xe2}, 12, ""},
+		{"empty", nil, 0, ""},
+
+		{"b", []byte{0x21, 0x00, 0x00, 0x00, 0x00, 0x00}, 1, "b=33 exceeds 32 bits"},
+		{"constant b", []byte{0xe1, 0x89, 0x00, 0x00, 0x00, 0x00}, 1, "b=33 exceeds 32 bits"},
+		{"bx", []byte{0x84, 0x1d, 0x0, 0x8, 0x2c, 0xf7, 0xac, 0x2, 0x97, 0x43, 0x15, 0x73, 0x13, 0xe2}, 12, "plus bx=29 exceeds"},
+		{"truncated", []byte{0x07, 0xaa, 0x9c, 0xf6}, 4, "truncated"},
+		{"trailing", []byte{0xc8, 0x89, 0x00}, 1, "1 bytes after the last block"},
+		{"missing block", nil, 1, "truncated block header"},
+		{"exception count", []byte{0x44, 0xd, 0x97, 0x43, 0x15, 0x73, 0x13, 0xe2, 0xf, 0xb}, 12, "13 exceptions in a block of 12 values"},
+		{"exception index", []byte{0x44, 0x1, 0x97, 0x43, 0x15, 0x73, 0x13, 0xe2, 0xf, 0xc}, 12, "at index 12 in a block of 12 values"},
+		{"exception order", []byte{0x44, 0x2, 0x97, 0x43, 0x15, 0x73, 0x13, 0xe2, 0xf, 0xf, 0xb, 0x1}, 12, "not in ascending order"},
+		{"exception width", []byte{0x44, 0x1, 0x97, 0x43, 0x15, 0x73, 0x13, 0xe2, 0xfa, 0xff, 0xff, 0xff, 0xff, 0xb}, 12, "exceeds 32 bits when shifted"},
+		{"variable byte", []byte{0x44, 0x1, 0x97, 0x43, 0x15, 0x73, 0x13, 0xe2, 0xfb, 0xb}, 12, "invalid variable byte"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			consumed, err := Validate(test.input, test.n)
+			if test.want == "" {
+				if err != nil || consumed != len(test.input) {
+					t.Fatalf("Validate = %d, %v, want %d, nil", consumed, err, len(test.input))
+				}
+				return
+			}
+			ferr, ok := err.(*FormatError)
+			if !ok {
+				t.Fatalf("Validate = %d, %v, want a *FormatError", consumed, err)
+			}
+			if !strings.Contains(ferr.Reason, test.want) {
+				t.Fatalf("Validate: got %q, want %q", ferr.Reason, test.want)
+			}
+		})
+	}
+}
+
+// TestValidateCorrupt checks that streams which pass Validate can be decoded
+// without out of range accesses.
+func TestValidateCorrupt(t *testing.T) {
+	input, want := readTestdata(t, "trigram_592137")
+	// Use the first 8 blocks, so that single bit flips are likely to be found:
+	end := P4nblocks256v32(input, len(want))[8].Offset
+	input, want = input[:end], want[:8*256]
+	if _, err := Validate(input, len(want)); err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		corrupt := make([]byte, len(input)+32)
+		copy(corrupt, input)
+		corrupt[rnd.Intn(len(input))] ^= 1 << uint(rnd.Intn(8))
+		consumed, err := Validate(corrupt[:len(input)], len(want))
+		if err != nil {
+			continue
+		}
+		output := make([]uint32, len(want))
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("decoding a valid stream panicked: %v", r)
+				}
+			}()
+			if got := P4ndec256v32(corrupt, output); got != consumed {
+				t.Fatalf("read: got %d, want %d", got, consumed)
+			}
+		}()
+	}
+}